@@ -117,7 +117,6 @@ func (l *List) Run(ctx context.Context) error {
 			}(did)
 		}
 	}
-	return ctx.Err()
 }
 
 func (l *List) addToList(ctx context.Context, did string) error {
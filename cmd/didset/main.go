@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/didset"
+	"github.com/uabluerail/bsky-tools/didset/config"
+	"github.com/uabluerail/bsky-tools/didset/remote"
+	"github.com/uabluerail/bsky-tools/xrpcauth"
+)
+
+func main() {
+	app := &cli.App{
+		Usage: "evaluate DID sets defined in a config file",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "host",
+				Usage: "API host name",
+				Value: "bsky.social"},
+			&cli.PathFlag{
+				Name:  "auth-file",
+				Usage: "path to the file with auth info"},
+			&cli.PathFlag{
+				Name:     "config",
+				Usage:    "path to the DID set config",
+				Required: true},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "print all members of a set",
+				ArgsUsage: "<set>",
+				Action:    runList,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "sources",
+						Usage: "print sources of each member"},
+					&cli.BoolFlag{
+						Name:  "stream",
+						Usage: "print members as they are fetched, without sorting or removing duplicates"},
+				},
+			},
+			{
+				Name:   "serve",
+				Usage:  "serve all sets over HTTP",
+				Action: runServe,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "address to listen on",
+						Value: ":8080"},
+					&cli.DurationFlag{
+						Name:  "refresh",
+						Usage: "how often to check the sets for changes",
+						Value: time.Minute},
+				},
+			},
+			{
+				Name:      "explain",
+				Usage:     "print sources that contributed a DID to a set",
+				ArgsUsage: "<set> <did>",
+				Action:    runExplain,
+			},
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func createClient(cCtx *cli.Context) *xrpc.Client {
+	f := cCtx.Path("auth-file")
+	var r *xrpc.Client
+	if f == "" {
+		r = xrpcauth.NewAnonymousClient(context.Background())
+	} else {
+		r = xrpcauth.NewClient(context.Background(), f)
+	}
+	host := cCtx.String("host")
+
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "https://" + host
+	}
+	r.Host = host
+
+	return r
+}
+
+func loadSet(cCtx *cli.Context, name string) (didset.QueryableDIDSet, error) {
+	cfg, err := config.Load(cCtx.Path("config"))
+	if err != nil {
+		return nil, err
+	}
+	return cfg.CompileSet(cCtx.Context, createClient(cCtx), name)
+}
+
+func runList(cCtx *cli.Context) error {
+	if cCtx.NArg() != 1 {
+		return fmt.Errorf("expected exactly one argument")
+	}
+	set, err := loadSet(cCtx, cCtx.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("stream") {
+		return didset.Iterate(cCtx.Context, set, func(did string) bool {
+			fmt.Println(did)
+			return true
+		})
+	}
+
+	annotated, ok := set.(didset.AnnotatedDIDSet)
+	if !cCtx.Bool("sources") || !ok {
+		dids, err := set.GetDIDs(cCtx.Context)
+		if err != nil {
+			return err
+		}
+		r := make([]string, 0, len(dids))
+		for did := range dids {
+			r = append(r, did)
+		}
+		sort.Strings(r)
+		for _, did := range r {
+			fmt.Println(did)
+		}
+		return nil
+	}
+
+	entries, err := annotated.GetAnnotated(cCtx.Context)
+	if err != nil {
+		return err
+	}
+	r := make([]string, 0, len(entries))
+	for did := range entries {
+		r = append(r, did)
+	}
+	sort.Strings(r)
+	for _, did := range r {
+		fmt.Printf("%s\t%s\n", did, strings.Join(entries[did], ","))
+	}
+	return nil
+}
+
+func runExplain(cCtx *cli.Context) error {
+	if cCtx.NArg() != 2 {
+		return fmt.Errorf("expected exactly two arguments")
+	}
+	set, err := loadSet(cCtx, cCtx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	did := cCtx.Args().Get(1)
+
+	sources, ok, err := didset.Explain(cCtx.Context, set, did)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Printf("%s is not in the set\n", did)
+		return nil
+	}
+	if len(sources) == 0 {
+		fmt.Printf("%s is in the set, sources are unknown\n", did)
+		return nil
+	}
+	fmt.Printf("%s is in the set because of: %s\n", did, strings.Join(sources, ", "))
+	return nil
+}
+
+func runServe(cCtx *cli.Context) error {
+	cfg, err := config.Load(cCtx.Path("config"))
+	if err != nil {
+		return err
+	}
+	compiled, err := cfg.Compile(cCtx.Context, createClient(cCtx))
+	if err != nil {
+		return err
+	}
+	sets := map[string]didset.DIDSet{}
+	for name, set := range compiled {
+		sets[name] = set
+	}
+
+	srv := remote.NewServer(sets)
+	srv.Refresh = cCtx.Duration("refresh")
+	return srv.Run(cCtx.Context, cCtx.String("addr"))
+}
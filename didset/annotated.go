@@ -0,0 +1,227 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// AnnotatedDIDSet is a set that can tell which sources each member came from.
+// Union, Intersection and Difference implement it when all of their operands
+// are queryable, propagating annotations from the sets they are composed of.
+// Members that came from sets without annotations have no sources.
+type AnnotatedDIDSet interface {
+	QueryableDIDSet
+	// GetAnnotated returns all members of the set, along with the names
+	// of sources that contributed each of them.
+	GetAnnotated(ctx context.Context) (map[string][]string, error)
+	// Explain returns the names of sources that contributed the DID,
+	// and false if it is not a member of the set.
+	Explain(ctx context.Context, did string) ([]string, bool, error)
+}
+
+type annotated struct {
+	name string
+	set  QueryableDIDSet
+}
+
+// Annotate marks all members of the set as coming from the source with
+// the given name, e.g., "followers-of:alice" or "list:xyz".
+func Annotate(name string, set QueryableDIDSet) AnnotatedDIDSet {
+	return &annotated{name: name, set: set}
+}
+
+func (a *annotated) GetDIDs(ctx context.Context) (StringSet, error) {
+	return a.set.GetDIDs(ctx)
+}
+
+func (a *annotated) Contains(ctx context.Context, did string) (bool, error) {
+	return a.set.Contains(ctx, did)
+}
+
+func (a *annotated) GetCompact(ctx context.Context) (*CompactSet, error) {
+	return GetCompact(ctx, a.set)
+}
+
+func (a *annotated) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	dids, err := a.set.GetDIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string][]string, len(dids))
+	for did := range dids {
+		r[did] = []string{a.name}
+	}
+	return r, nil
+}
+
+func (a *annotated) Explain(ctx context.Context, did string) ([]string, bool, error) {
+	ok, err := a.set.Contains(ctx, did)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return []string{a.name}, true, nil
+}
+
+// Explain returns the sources that contributed the DID to the set, if
+// the set supports annotations. For other sets only the membership is checked.
+func Explain(ctx context.Context, set DIDSet, did string) ([]string, bool, error) {
+	if a, ok := set.(AnnotatedDIDSet); ok {
+		return a.Explain(ctx, did)
+	}
+	ok, err := contains(ctx, set, did)
+	return nil, ok, err
+}
+
+// annotator is implemented by AnnotatedDIDSet and by set operations over
+// non-queryable sets, which keep annotations but can't Explain single DIDs.
+type annotator interface {
+	GetAnnotated(ctx context.Context) (map[string][]string, error)
+}
+
+// getAnnotated returns members of the set with their sources, which are empty
+// if the set doesn't implement GetAnnotated.
+func getAnnotated(ctx context.Context, set DIDSet) (map[string][]string, error) {
+	if a, ok := set.(annotator); ok {
+		return a.GetAnnotated(ctx)
+	}
+	dids, err := set.GetDIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string][]string, len(dids))
+	for did := range dids {
+		r[did] = nil
+	}
+	return r, nil
+}
+
+// mergeSources returns a sorted union of the source lists.
+func mergeSources(lists ...[]string) []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, l := range lists {
+		for _, s := range l {
+			if !seen[s] {
+				seen[s] = true
+				r = append(r, s)
+			}
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (u *union) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	r := map[string][]string{}
+	for i, s := range u.sets {
+		entries, err := getAnnotated(ctx, s)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %d'th set of union: %w", i, err)
+		}
+		for did, sources := range entries {
+			r[did] = mergeSources(r[did], sources)
+		}
+	}
+	return r, nil
+}
+
+func (u *union) Explain(ctx context.Context, did string) ([]string, bool, error) {
+	var r []string
+	found := false
+	for i, s := range u.sets {
+		sources, ok, err := Explain(ctx, s, did)
+		if err != nil {
+			return nil, false, fmt.Errorf("evaluating %d'th set of union: %w", i, err)
+		}
+		if ok {
+			found = true
+			r = mergeSources(r, sources)
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	return r, true, nil
+}
+
+func (i *intersection) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	if len(i.sets) == 0 {
+		return map[string][]string{}, nil
+	}
+
+	var r map[string][]string
+	for n, s := range i.sets {
+		entries, err := getAnnotated(ctx, s)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %d'th set of intersection: %w", n, err)
+		}
+		if r == nil {
+			r = map[string][]string{}
+			for did, sources := range entries {
+				r[did] = mergeSources(sources)
+			}
+			continue
+		}
+		for did := range r {
+			sources, ok := entries[did]
+			if !ok {
+				delete(r, did)
+				continue
+			}
+			r[did] = mergeSources(r[did], sources)
+		}
+	}
+	return r, nil
+}
+
+func (i *intersection) Explain(ctx context.Context, did string) ([]string, bool, error) {
+	if len(i.sets) == 0 {
+		return nil, false, nil
+	}
+	r := []string{}
+	for n, s := range i.sets {
+		sources, ok, err := Explain(ctx, s, did)
+		if err != nil {
+			return nil, false, fmt.Errorf("evaluating %d'th set of intersection: %w", n, err)
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		r = mergeSources(r, sources)
+	}
+	return r, true, nil
+}
+
+func (d *difference) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	left, err := getAnnotated(ctx, d.left)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating left side of a difference: %w", err)
+	}
+	right, err := d.right.GetDIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating right side of a difference: %w", err)
+	}
+	for did := range right {
+		delete(left, did)
+	}
+	return left, nil
+}
+
+func (d *difference) Explain(ctx context.Context, did string) ([]string, bool, error) {
+	sources, ok, err := Explain(ctx, d.left, did)
+	if err != nil {
+		return nil, false, fmt.Errorf("evaluating left side of a difference: %w", err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	excluded, err := contains(ctx, d.right, did)
+	if err != nil {
+		return nil, false, fmt.Errorf("evaluating right side of a difference: %w", err)
+	}
+	if excluded {
+		return nil, false, nil
+	}
+	return sources, true, nil
+}
@@ -2,30 +2,181 @@ package didset
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/atomicfile"
 )
 
+// CachedDIDSet is a set that is periodically refreshed in background.
+//
+// If a refresh fails, the set keeps serving the last successfully fetched
+// data until it becomes older than the max staleness threshold. After that
+// all queries return the error from the last refresh attempt.
+type CachedDIDSet interface {
+	QueryableDIDSet
+	// Age returns how much time has passed since the last successful refresh.
+	// Returns 0 if there wasn't any yet.
+	Age() time.Duration
+	// LastError returns the error from the last refresh attempt,
+	// or nil if it has succeeded.
+	LastError() error
+	// Stale returns true if the data was loaded from a snapshot
+	// and wasn't refreshed from the source yet.
+	Stale() bool
+	// Subscribe returns a channel that receives the changes after every
+	// refresh that has modified the set. The first diff is relative to the
+	// data available at the time of the call (or to an empty set, if there
+	// was none). Refreshes wait for subscribers to receive the diff, so the
+	// channel must be read from until ctx is done. The channel is closed
+	// when either ctx or the context passed to Cached is done.
+	Subscribe(ctx context.Context) <-chan Diff
+	// GetCompact returns the cached data without copying it.
+	GetCompact(ctx context.Context) (*CompactSet, error)
+}
+
+type CacheOption func(*caching)
+
+// WithMaxStaleness sets for how long the last successfully fetched data
+// can be served after refreshes start failing. Zero means that queries fail
+// as soon as a refresh fails. Default is 3 refresh intervals.
+func WithMaxStaleness(d time.Duration) CacheOption {
+	return func(c *caching) {
+		c.maxStaleness = d
+	}
+}
+
+// WithSnapshotFile enables persisting the cached data to a file after
+// every successful refresh. If the file exists at startup, its content is
+// served immediately (and marked as stale) instead of waiting for
+// the first refresh to complete. Age of the snapshot counts towards
+// max staleness, so a snapshot older than that is ignored.
+func WithSnapshotFile(path string) CacheOption {
+	return func(c *caching) {
+		c.snapshotFile = path
+	}
+}
+
+// WithBloomFilter adds a Bloom filter with the given false positive rate
+// in front of Contains. See NewCompactSetWithBloomFilter.
+func WithBloomFilter(falsePositiveRate float64) CacheOption {
+	return func(c *caching) {
+		c.bloomFalsePositiveRate = falsePositiveRate
+	}
+}
+
 type caching struct {
-	source DIDSet
+	source                 DIDSet
+	maxStaleness           time.Duration
+	snapshotFile           string
+	bloomFalsePositiveRate float64
+
+	done <-chan struct{}
 
 	mu             sync.Mutex
-	entries        StringSet
+	entries        *CompactSet
+	lastSuccess    time.Time
+	stale          bool
 	waitUntilReady chan struct{}
+	readyOnce      sync.Once
 	err            error
+	stopped        error
+	subscribers    map[*subscriber]bool
+}
+
+type subscriber struct {
+	ctx context.Context
+	ch  chan Diff
+
+	// mu serializes sending to ch with closing it.
+	mu     sync.Mutex
+	closed bool
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+type snapshot struct {
+	SavedAt time.Time `json:"saved_at"`
+	DIDs    []string  `json:"dids"`
+}
+
+func (c *caching) markReady() {
+	c.readyOnce.Do(func() { close(c.waitUntilReady) })
+}
+
+func (c *caching) loadSnapshot() error {
+	b, err := os.ReadFile(c.snapshotFile)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return fmt.Errorf("unmarshaling snapshot: %w", err)
+	}
+	// Queries would fail on such a snapshot anyway, so wait for the first
+	// refresh instead, as if there was no snapshot.
+	if age := time.Since(snap.SavedAt); snap.SavedAt.IsZero() || age > c.maxStaleness {
+		return fmt.Errorf("snapshot is too stale (saved %s ago)", age.Round(time.Second))
+	}
+
+	entries := compactFromSlice(snap.DIDs, c.bloomFalsePositiveRate)
+
+	c.mu.Lock()
+	c.entries = entries
+	c.lastSuccess = snap.SavedAt
+	c.stale = true
+	c.mu.Unlock()
+	c.markReady()
+	return nil
+}
+
+func (c *caching) saveSnapshot(set *CompactSet, ts time.Time) error {
+	snap := snapshot{SavedAt: ts, DIDs: make([]string, 0, set.Len())}
+	set.ForEach(func(did string) bool {
+		snap.DIDs = append(snap.DIDs, did)
+		return true
+	})
+	sort.Strings(snap.DIDs)
+
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if err := atomicfile.WriteFile(c.snapshotFile, b, 0644); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
 }
 
 func (c *caching) run(ctx context.Context, refresh time.Duration) {
 	log := zerolog.Ctx(ctx).With().Str("module", "didset").Logger()
 	ctx = log.WithContext(ctx)
 
-	waitChanClosed := false
+	if c.snapshotFile != "" {
+		if err := c.loadSnapshot(); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				log.Info().Msgf("Snapshot file %q doesn't exist yet", c.snapshotFile)
+			} else {
+				log.Warn().Err(err).Msgf("Failed to load snapshot from %q", c.snapshotFile)
+			}
+		}
+	}
 
 	t := time.NewTicker(refresh)
 	tr := make(chan time.Time, 1)
@@ -33,7 +184,7 @@ func (c *caching) run(ctx context.Context, refresh time.Duration) {
 	for {
 		select {
 		case <-tr:
-			set, err := c.source.GetDIDs(ctx)
+			dids, err := c.source.GetDIDs(ctx)
 			if err != nil {
 				log.Warn().Err(err).Msgf("Failed to refresh cached list")
 				c.mu.Lock()
@@ -53,25 +204,89 @@ func (c *caching) run(ctx context.Context, refresh time.Duration) {
 				}
 				break
 			}
+			set := newCompactSet(dids, c.bloomFalsePositiveRate)
+			now := time.Now()
 			c.mu.Lock()
+			prev := c.entries
 			c.entries = set
+			c.lastSuccess = now
+			c.stale = false
 			c.err = nil
+			subscribers := []*subscriber{}
+			for s := range c.subscribers {
+				subscribers = append(subscribers, s)
+			}
 			c.mu.Unlock()
-			if !waitChanClosed {
-				close(c.waitUntilReady)
-				waitChanClosed = true
+			c.markReady()
+
+			if len(subscribers) > 0 {
+				c.notify(ctx, subscribers, prev.Diff(set))
+			}
+
+			if c.snapshotFile != "" {
+				if err := c.saveSnapshot(set, now); err != nil {
+					log.Warn().Err(err).Msgf("Failed to save snapshot to %q", c.snapshotFile)
+				}
 			}
 		case v := <-t.C:
 			tr <- v
 		case <-ctx.Done():
 			c.mu.Lock()
 			defer c.mu.Unlock()
-			c.err = fmt.Errorf("context of the background goroutine is done: %w", ctx.Err())
+			c.stopped = fmt.Errorf("context of the background goroutine is done: %w", ctx.Err())
+			for s := range c.subscribers {
+				s.close()
+			}
+			c.subscribers = nil
+			return
+		}
+	}
+}
+
+func (c *caching) notify(ctx context.Context, subscribers []*subscriber, diff Diff) {
+	if diff.Empty() {
+		return
+	}
+	for _, s := range subscribers {
+		s.mu.Lock()
+		if !s.closed {
+			select {
+			case s.ch <- diff:
+			case <-s.ctx.Done():
+			case <-ctx.Done():
+			}
+		}
+		s.mu.Unlock()
+		if ctx.Err() != nil {
 			return
 		}
 	}
 }
 
+func (c *caching) Subscribe(ctx context.Context) <-chan Diff {
+	s := &subscriber{ctx: ctx, ch: make(chan Diff, 1)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped != nil {
+		close(s.ch)
+		return s.ch
+	}
+	c.subscribers[s] = true
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.done:
+		}
+		c.mu.Lock()
+		delete(c.subscribers, s)
+		c.mu.Unlock()
+		s.close()
+	}()
+	return s.ch
+}
+
 func (c *caching) GetDIDs(ctx context.Context) (StringSet, error) {
 	select {
 	case <-ctx.Done():
@@ -82,7 +297,26 @@ func (c *caching) GetDIDs(ctx context.Context) (StringSet, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	return c.entries.Clone(), c.err
+	if err := c.checkLocked(); err != nil {
+		return nil, err
+	}
+	return c.entries.GetDIDs(ctx)
+}
+
+func (c *caching) GetCompact(ctx context.Context) (*CompactSet, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.waitUntilReady:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkLocked(); err != nil {
+		return nil, err
+	}
+	return c.entries, nil
 }
 
 func (c *caching) Contains(ctx context.Context, did string) (bool, error) {
@@ -93,21 +327,73 @@ func (c *caching) Contains(ctx context.Context, did string) (bool, error) {
 	}
 
 	c.mu.Lock()
-	if c.err != nil {
+	if err := c.checkLocked(); err != nil {
 		defer c.mu.Unlock()
-		return false, c.err
+		return false, err
 	}
-	r := c.entries[did]
+	entries := c.entries
 	c.mu.Unlock()
 
-	return r, nil
+	return entries.Has(did), nil
+}
+
+// checkLocked returns an error if the cached data must not be used.
+// Must be called with c.mu held.
+func (c *caching) checkLocked() error {
+	if c.stopped != nil {
+		return c.stopped
+	}
+	if c.err == nil && !c.stale {
+		return nil
+	}
+	age := time.Since(c.lastSuccess)
+	if !c.lastSuccess.IsZero() && age <= c.maxStaleness {
+		return nil
+	}
+	if c.err == nil {
+		return fmt.Errorf("snapshot is too stale (saved %s ago) and the first refresh hasn't completed yet", age.Round(time.Millisecond))
+	}
+	return fmt.Errorf("cached data is too stale (last refreshed %s ago): %w", age.Round(time.Millisecond), c.err)
+}
+
+func (c *caching) Age() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastSuccess.IsZero() {
+		return 0
+	}
+	return time.Since(c.lastSuccess)
 }
 
-func Cached(ctx context.Context, refresh time.Duration, source DIDSet) QueryableDIDSet {
+func (c *caching) Stale() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stale
+}
+
+func (c *caching) LastError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped != nil {
+		return c.stopped
+	}
+	return c.err
+}
+
+func Cached(ctx context.Context, refresh time.Duration, source DIDSet, opts ...CacheOption) CachedDIDSet {
 	r := &caching{
-		entries:        StringSet{},
+		entries:        NewCompactSet(nil),
 		source:         source,
+		done:           ctx.Done(),
+		maxStaleness:   3 * refresh,
 		waitUntilReady: make(chan struct{}),
+		subscribers:    map[*subscriber]bool{},
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
 	go r.run(ctx, refresh)
 	return r
@@ -0,0 +1,230 @@
+package didset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSource returns the configured DIDs or error. If blocked, GetDIDs
+// waits until it is unblocked or ctx is done.
+type fakeSource struct {
+	mu      sync.Mutex
+	dids    StringSet
+	err     error
+	blocked chan struct{}
+}
+
+func (s *fakeSource) set(dids StringSet, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dids, s.err = dids, err
+}
+
+func (s *fakeSource) GetDIDs(ctx context.Context) (StringSet, error) {
+	s.mu.Lock()
+	blocked := s.blocked
+	s.mu.Unlock()
+	if blocked != nil {
+		select {
+		case <-blocked:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.dids.Clone(), nil
+}
+
+// eventually calls fn until it returns true or the timeout expires.
+func eventually(t *testing.T, timeout time.Duration, fn func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met after %s", timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscribeClosesChannel(t *testing.T) {
+	tests := []struct {
+		name             string
+		cancelCached     bool
+		cancelSubscriber bool
+		// sameContext passes the context of Cached to Subscribe too.
+		sameContext bool
+	}{
+		{name: "cached context", cancelCached: true},
+		{name: "subscriber context", cancelSubscriber: true},
+		{name: "shared context", sameContext: true, cancelCached: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cachedCtx, cancelCached := context.WithCancel(context.Background())
+			defer cancelCached()
+			subCtx, cancelSubscriber := context.WithCancel(context.Background())
+			defer cancelSubscriber()
+			if tc.sameContext {
+				subCtx = cachedCtx
+			}
+
+			c := Cached(cachedCtx, time.Hour, Const("did:plc:a"))
+			ch := c.Subscribe(subCtx)
+			if _, err := c.GetDIDs(context.Background()); err != nil {
+				t.Fatalf("GetDIDs: %s", err)
+			}
+
+			if tc.cancelCached {
+				cancelCached()
+			}
+			if tc.cancelSubscriber {
+				cancelSubscriber()
+			}
+
+			done := make(chan struct{})
+			go func() {
+				for range ch {
+				}
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("channel wasn't closed")
+			}
+		})
+	}
+}
+
+func writeSnapshot(t *testing.T, path string, savedAt time.Time, dids ...string) {
+	t.Helper()
+	b, err := json.Marshal(snapshot{SavedAt: savedAt, DIDs: dids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCachedSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	// The first instance saves the snapshot after a refresh.
+	source := &fakeSource{dids: StringSet{"did:plc:a": true}}
+	Cached(ctx, time.Hour, source, WithSnapshotFile(path))
+	eventually(t, 5*time.Second, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+
+	// The second one serves it while the source is not responding.
+	blocked := &fakeSource{dids: StringSet{"did:plc:b": true}, blocked: make(chan struct{})}
+	c := Cached(ctx, time.Hour, blocked, WithSnapshotFile(path))
+	got, err := c.GetDIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetDIDs: %s", err)
+	}
+	if diff := compareSets(got, []string{"did:plc:a"}); diff != "" {
+		t.Errorf("unexpected snapshot content: %s", diff)
+	}
+	if !c.Stale() {
+		t.Errorf("Stale() = false before the first refresh")
+	}
+
+	close(blocked.blocked)
+	eventually(t, 5*time.Second, func() bool { return !c.Stale() })
+	got, err = c.GetDIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetDIDs: %s", err)
+	}
+	if diff := compareSets(got, []string{"did:plc:b"}); diff != "" {
+		t.Errorf("unexpected content after refresh: %s", diff)
+	}
+}
+
+func TestCachedIgnoresTooStaleSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	writeSnapshot(t, path, time.Now().Add(-time.Hour), "did:plc:a")
+
+	blocked := &fakeSource{dids: StringSet{"did:plc:b": true}, blocked: make(chan struct{})}
+	c := Cached(ctx, time.Hour, blocked, WithSnapshotFile(path), WithMaxStaleness(time.Minute))
+
+	// Queries must wait for the first refresh instead of using the snapshot.
+	shortCtx, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := c.GetDIDs(shortCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(blocked.blocked)
+	got, err := c.GetDIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetDIDs: %s", err)
+	}
+	if diff := compareSets(got, []string{"did:plc:b"}); diff != "" {
+		t.Errorf("unexpected content: %s", diff)
+	}
+}
+
+func TestCachedMaxStaleness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &fakeSource{dids: StringSet{"did:plc:a": true}}
+	c := Cached(ctx, 10*time.Millisecond, source, WithMaxStaleness(300*time.Millisecond))
+	if _, err := c.GetDIDs(ctx); err != nil {
+		t.Fatalf("GetDIDs: %s", err)
+	}
+
+	// Within the limit the last good data keeps being served.
+	sourceErr := errors.New("source is down")
+	source.set(nil, sourceErr)
+	eventually(t, 5*time.Second, func() bool { return c.LastError() != nil })
+	if c.Age() < 300*time.Millisecond {
+		got, err := c.GetDIDs(ctx)
+		if err != nil {
+			t.Fatalf("GetDIDs within the staleness limit: %s", err)
+		}
+		if diff := compareSets(got, []string{"did:plc:a"}); diff != "" {
+			t.Errorf("unexpected content: %s", diff)
+		}
+	}
+
+	// Past the limit the source error is returned.
+	eventually(t, 5*time.Second, func() bool { return c.Age() > 300*time.Millisecond })
+	if _, err := c.GetDIDs(ctx); !errors.Is(err, sourceErr) {
+		t.Errorf("got error %v, want it to wrap %v", err, sourceErr)
+	}
+	if _, err := c.Contains(ctx, "did:plc:a"); !errors.Is(err, sourceErr) {
+		t.Errorf("Contains: got error %v, want it to wrap %v", err, sourceErr)
+	}
+
+	// And once the source recovers, so does the set.
+	source.set(StringSet{"did:plc:b": true}, nil)
+	eventually(t, 5*time.Second, func() bool { return c.LastError() == nil })
+	got, err := c.GetDIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetDIDs after recovery: %s", err)
+	}
+	if diff := compareSets(got, []string{"did:plc:b"}); diff != "" {
+		t.Errorf("unexpected content after recovery: %s", diff)
+	}
+}
@@ -0,0 +1,269 @@
+package didset
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+const plcPrefix = "did:plc:"
+
+// CompactSet is an immutable set of DIDs stored in a single sorted byte slice,
+// with "did:plc:" prefixes stripped. It takes a fraction of the memory of
+// an equivalent StringSet and can be shared between goroutines without copying.
+type CompactSet struct {
+	// data contains keys of all members, concatenated in sorted order.
+	data []byte
+	// offsets[i] is the start of i'th key in data, with an extra
+	// element at the end equal to len(data).
+	offsets []uint32
+	bloom   *bloomFilter
+}
+
+// CompactDIDSet is implemented by sets that can return their members
+// as a CompactSet without copying.
+type CompactDIDSet interface {
+	DIDSet
+	GetCompact(ctx context.Context) (*CompactSet, error)
+}
+
+// key returns the representation of the DID stored in CompactSet:
+// method-specific ID for PLC DIDs, and the whole string prefixed with '!'
+// for anything else. '!' is not a valid character in PLC IDs, so the two
+// can't be confused.
+func key(did string) string {
+	if rest, ok := strings.CutPrefix(did, plcPrefix); ok && isPLCID(rest) {
+		return rest
+	}
+	return "!" + did
+}
+
+func unkey(k []byte) string {
+	if len(k) > 0 && k[0] == '!' {
+		return string(k[1:])
+	}
+	return plcPrefix + string(k)
+}
+
+// isPLCID returns true if s consists only of base32 characters used in PLC IDs.
+func isPLCID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '2' && c <= '7') {
+			return false
+		}
+	}
+	return true
+}
+
+func NewCompactSet(dids StringSet) *CompactSet {
+	return newCompactSet(dids, 0)
+}
+
+// NewCompactSetWithBloomFilter is like NewCompactSet, but also adds a Bloom
+// filter with the given false positive rate (e.g., 0.01) in front of lookups.
+// It speeds up Contains for DIDs that are not in the set, at the cost of
+// about 10 bits per member for 1% false positive rate.
+func NewCompactSetWithBloomFilter(dids StringSet, falsePositiveRate float64) *CompactSet {
+	return newCompactSet(dids, falsePositiveRate)
+}
+
+func newCompactSet(dids StringSet, falsePositiveRate float64) *CompactSet {
+	keys := make([]string, 0, len(dids))
+	for did := range dids {
+		keys = append(keys, key(did))
+	}
+	return compactFromKeys(keys, falsePositiveRate)
+}
+
+// compactFromSlice is the same as newCompactSet, but takes a slice,
+// which may contain duplicates.
+func compactFromSlice(dids []string, falsePositiveRate float64) *CompactSet {
+	keys := make([]string, 0, len(dids))
+	for _, did := range dids {
+		keys = append(keys, key(did))
+	}
+	return compactFromKeys(keys, falsePositiveRate)
+}
+
+func compactFromKeys(keys []string, falsePositiveRate float64) *CompactSet {
+	sort.Strings(keys)
+	size := 0
+	for _, k := range keys {
+		size += len(k)
+	}
+
+	r := &CompactSet{
+		data:    make([]byte, 0, size),
+		offsets: make([]uint32, 0, len(keys)+1),
+	}
+	for i, k := range keys {
+		if i > 0 && keys[i-1] == k {
+			continue
+		}
+		r.offsets = append(r.offsets, uint32(len(r.data)))
+		r.data = append(r.data, k...)
+	}
+	r.offsets = append(r.offsets, uint32(len(r.data)))
+
+	if falsePositiveRate > 0 && falsePositiveRate < 1 {
+		r.bloom = newBloomFilter(r.Len(), falsePositiveRate)
+		for i := 0; i < r.Len(); i++ {
+			r.bloom.add(r.key(i))
+		}
+	}
+	return r
+}
+
+func (s *CompactSet) Len() int {
+	if s == nil || len(s.offsets) == 0 {
+		return 0
+	}
+	return len(s.offsets) - 1
+}
+
+func (s *CompactSet) key(i int) []byte {
+	return s.data[s.offsets[i]:s.offsets[i+1]]
+}
+
+// At returns the i'th DID. Members are ordered by their internal representation,
+// which is stable, but not the same as the lexicographic order of DIDs.
+func (s *CompactSet) At(i int) string {
+	return unkey(s.key(i))
+}
+
+// Has returns true if the DID is a member of the set.
+func (s *CompactSet) Has(did string) bool {
+	n := s.Len()
+	if n == 0 {
+		return false
+	}
+	k := []byte(key(did))
+	if s.bloom != nil && !s.bloom.mayContain(k) {
+		return false
+	}
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(s.key(i), k) >= 0
+	})
+	return i < n && bytes.Equal(s.key(i), k)
+}
+
+// ForEach calls fn for every member until it returns false.
+func (s *CompactSet) ForEach(fn func(did string) bool) {
+	for i := 0; i < s.Len(); i++ {
+		if !fn(s.At(i)) {
+			return
+		}
+	}
+}
+
+func (s *CompactSet) GetDIDs(ctx context.Context) (StringSet, error) {
+	r := make(StringSet, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		r[s.At(i)] = true
+	}
+	return r, nil
+}
+
+func (s *CompactSet) Contains(ctx context.Context, did string) (bool, error) {
+	return s.Has(did), nil
+}
+
+func (s *CompactSet) GetCompact(ctx context.Context) (*CompactSet, error) {
+	return s, nil
+}
+
+// Diff returns the changes needed to turn s into next.
+func (s *CompactSet) Diff(next *CompactSet) Diff {
+	r := Diff{Added: StringSet{}, Removed: StringSet{}}
+	i, j := 0, 0
+	for i < s.Len() || j < next.Len() {
+		switch {
+		case j >= next.Len():
+			r.Removed[s.At(i)] = true
+			i++
+		case i >= s.Len():
+			r.Added[next.At(j)] = true
+			j++
+		default:
+			switch c := bytes.Compare(s.key(i), next.key(j)); {
+			case c < 0:
+				r.Removed[s.At(i)] = true
+				i++
+			case c > 0:
+				r.Added[next.At(j)] = true
+				j++
+			default:
+				i++
+				j++
+			}
+		}
+	}
+	return r
+}
+
+// GetCompact returns members of the set as a CompactSet. Sets that implement
+// CompactDIDSet return it without copying, for others all members are fetched
+// with GetDIDs.
+func GetCompact(ctx context.Context, set DIDSet) (*CompactSet, error) {
+	if c, ok := set.(CompactDIDSet); ok {
+		return c.GetCompact(ctx)
+	}
+	dids, err := set.GetDIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewCompactSet(dids), nil
+}
+
+type bloomFilter struct {
+	bits []uint64
+	k    uint64
+}
+
+func newBloomFilter(n int, falsePositiveRate float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Max(1, math.Round(m/float64(n)*math.Ln2))
+	return &bloomFilter{
+		bits: make([]uint64, (uint64(m)+63)/64),
+		k:    uint64(k),
+	}
+}
+
+// hashes returns two hashes of the key for double hashing.
+func (b *bloomFilter) hashes(k []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(k)
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	return h1, h2 | 1
+}
+
+func (b *bloomFilter) add(k []byte) {
+	h1, h2 := b.hashes(k)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(k []byte) bool {
+	h1, h2 := b.hashes(k)
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
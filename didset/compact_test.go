@@ -0,0 +1,160 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// randomPLC returns a random DID with a valid PLC identifier.
+func randomPLC(rnd *rand.Rand) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	b := make([]byte, 24)
+	for i := range b {
+		b[i] = alphabet[rnd.Intn(len(alphabet))]
+	}
+	return plcPrefix + string(b)
+}
+
+func TestCompactSetRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		dids []string
+	}{
+		{"empty", nil},
+		{"plc", []string{"did:plc:ewvi7nxzyoun6zhxrhs64oiz", "did:plc:aaa", "did:plc:aa", "did:plc:z"}},
+		{"non-plc", []string{"did:web:example.com", "did:key:z6Mk", "not a DID"}},
+		{"not a valid PLC id", []string{"did:plc:UPPER", "did:plc:", "did:plc:a1", "did:plc:a/b"}},
+		{"looks like a key", []string{"!did:plc:abc", "!", "abc", "did:plc:abc"}},
+		{"mixed", []string{"did:plc:abc", "did:web:abc", "did:plc:ab", "did:web:ab", "did:plc:b"}},
+	}
+
+	for _, tc := range tests {
+		for _, bloom := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/bloom=%v", tc.name, bloom), func(t *testing.T) {
+				input := Const(tc.dids...).(StringSet)
+				set := NewCompactSet(input)
+				if bloom {
+					set = NewCompactSetWithBloomFilter(input, 0.01)
+				}
+
+				if set.Len() != len(input) {
+					t.Errorf("got Len() = %d, want %d", set.Len(), len(input))
+				}
+				got, err := set.GetDIDs(context.Background())
+				if err != nil {
+					t.Fatalf("GetDIDs: %s", err)
+				}
+				if diff := compareSets(got, tc.dids); diff != "" {
+					t.Errorf("unexpected result: %s", diff)
+				}
+				for _, did := range tc.dids {
+					if !set.Has(did) {
+						t.Errorf("Has(%q) = false, want true", did)
+					}
+				}
+				for i := 0; i < set.Len(); i++ {
+					if !input[set.At(i)] {
+						t.Errorf("At(%d) = %q, which is not in the input", i, set.At(i))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCompactSetHasAbsent(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	members := StringSet{}
+	for i := 0; i < 1000; i++ {
+		members[randomPLC(rnd)] = true
+	}
+	members["did:plc:abc"] = true
+	members["did:web:example.com"] = true
+
+	absent := []string{
+		"did:plc:ab", "did:plc:abcd", "did:plc:", "did:web:example.co",
+		"did:web:example.com.", "!did:web:example.com", "abc", "",
+	}
+	for i := 0; i < 10000; i++ {
+		did := randomPLC(rnd)
+		if !members[did] {
+			absent = append(absent, did)
+		}
+	}
+
+	for _, rate := range []float64{0, 0.01, 0.5} {
+		t.Run(fmt.Sprintf("rate=%v", rate), func(t *testing.T) {
+			set := NewCompactSetWithBloomFilter(members, rate)
+			for did := range members {
+				if !set.Has(did) {
+					t.Errorf("Has(%q) = false, want true", did)
+				}
+			}
+			for _, did := range absent {
+				if set.Has(did) {
+					t.Errorf("Has(%q) = true, want false", did)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactSetDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	var pool []string
+	for i := 0; i < 50; i++ {
+		pool = append(pool, randomPLC(rnd))
+	}
+	pool = append(pool, "did:web:a", "did:web:b", "did:plc:a", "did:plc:ab", "not a DID")
+	randomSubset := func() []string {
+		r := []string{}
+		for _, did := range pool {
+			if rnd.Intn(2) == 0 {
+				r = append(r, did)
+			}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		old, new []string
+	}{
+		{"both empty", nil, nil},
+		{"from empty", nil, []string{"did:plc:a", "did:web:a"}},
+		{"to empty", []string{"did:plc:a", "did:web:a"}, nil},
+		{"same", []string{"did:plc:a", "did:web:a"}, []string{"did:web:a", "did:plc:a"}},
+		{"prefixes", []string{"did:plc:a", "did:plc:abc"}, []string{"did:plc:ab", "did:plc:abc"}},
+		{"plc and non-plc", []string{"did:plc:b", "did:web:a"}, []string{"did:plc:a", "did:web:b"}},
+	}
+	for i := 0; i < 20; i++ {
+		tests = append(tests, struct {
+			name     string
+			old, new []string
+		}{fmt.Sprintf("random %d", i), randomSubset(), randomSubset()})
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old, new := Const(tc.old...).(StringSet), Const(tc.new...).(StringSet)
+			got := NewCompactSet(old).Diff(NewCompactSet(new))
+			want := ComputeDiff(old, new)
+			if diff := compareSets(got.Added, setMembers(want.Added)); diff != "" {
+				t.Errorf("Added: %s", diff)
+			}
+			if diff := compareSets(got.Removed, setMembers(want.Removed)); diff != "" {
+				t.Errorf("Removed: %s", diff)
+			}
+		})
+	}
+}
+
+func setMembers(set StringSet) []string {
+	r := make([]string, 0, len(set))
+	for did := range set {
+		r = append(r, did)
+	}
+	return r
+}
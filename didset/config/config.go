@@ -0,0 +1,488 @@
+// Package config builds DID sets from a declarative description.
+//
+// Example (JSON is accepted too, since it's a subset of YAML):
+//
+//	refresh: 30m
+//	sets:
+//	  alice-followers:
+//	    followers_of: did:plc:alice
+//	  my-blocks:
+//	    blocked_by: did:plc:me
+//	    refresh: 1h
+//	  curated:
+//	    list: at://did:plc:me/app.bsky.graph.list/xyz
+//	    list_source: records
+//	  allowed:
+//	    union: [alice-followers-not-blocked, curated]
+//	  alice-followers-not-blocked:
+//	    difference: {left: alice-followers, right: my-blocks}
+//	  widely-blocked:
+//	    threshold: {min: 2, sets: [my-blocks, curated], weights: {curated: 2}}
+//
+// Sets that fetch data from the network are always cached, with their own
+// refresh interval or the top-level one. Operations over other sets are
+// evaluated on the fly, unless they have a refresh interval set explicitly.
+// Every named set is instantiated once, so sets referenced multiple times
+// share the same cache.
+//
+// All compiled sets implement didset.AnnotatedDIDSet. Members of cached sets
+// are annotated with the name of the set, and operations propagate annotations
+// of their operands, so didset.Explain reports which named sets a DID came from.
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/didset"
+)
+
+// DefaultRefresh is used for sets that fetch data from the network,
+// if neither the set nor the config specify a refresh interval.
+const DefaultRefresh = time.Hour
+
+type Config struct {
+	// Refresh is the default refresh interval for sets that fetch data from the network.
+	Refresh time.Duration         `yaml:"refresh"`
+	Sets    map[string]*SetConfig `yaml:"sets"`
+}
+
+// SetConfig describes a single named set. Exactly one of the set kinds must be specified.
+type SetConfig struct {
+	FollowersOf     string `yaml:"followers_of"`
+	FollowsOf       string `yaml:"follows_of"`
+	FollowRecordsOf string `yaml:"follow_records_of"`
+	MutualsOf       string `yaml:"mutuals_of"`
+	// FollowNeighbourhood is the set of accounts within a few follow hops of an account.
+	FollowNeighbourhood *NeighbourhoodConfig `yaml:"follow_neighbourhood"`
+
+	BlockedBy    string `yaml:"blocked_by"`
+	BlockedUsers bool   `yaml:"blocked_users"`
+	MuteList     string `yaml:"mute_list"`
+	List         string `yaml:"list"`
+	// ListSource is either "appview" (default) or "records".
+	ListSource string `yaml:"list_source"`
+	// The following take anything that bskyurl.DetermineTarget understands as a post.
+	LikersOf           string `yaml:"likers_of"`
+	RepostersOf        string `yaml:"reposters_of"`
+	QuotersOf          string `yaml:"quoters_of"`
+	ThreadParticipants string `yaml:"thread_participants"`
+	// LabeledBy is the DID of a labeler. Requires Labels and LabelerHost.
+	LabeledBy   string   `yaml:"labeled_by"`
+	Labels      []string `yaml:"labels"`
+	LabelerHost string   `yaml:"labeler_host"`
+
+	Const []string `yaml:"const"`
+	// File is a path to a file or a directory with DIDs, one per line.
+	// It is checked for changes every Refresh interval (1 minute by default).
+	File string `yaml:"file"`
+	// ResolveHandles allows handles in File.
+	ResolveHandles bool `yaml:"resolve_handles"`
+
+	Union        []string          `yaml:"union"`
+	Intersection []string          `yaml:"intersection"`
+	Difference   *DifferenceConfig `yaml:"difference"`
+	Threshold    *ThresholdConfig  `yaml:"threshold"`
+
+	// Refresh enables caching with the given refresh interval.
+	// For file sets it is the polling interval instead.
+	Refresh time.Duration `yaml:"refresh"`
+	// MaxStaleness overrides the default max staleness of the cache.
+	// Not supported for file sets.
+	MaxStaleness time.Duration `yaml:"max_staleness"`
+	// SnapshotFile enables persisting cached data on disk.
+	// Not supported for file sets.
+	SnapshotFile string `yaml:"snapshot_file"`
+}
+
+type DifferenceConfig struct {
+	Left  string `yaml:"left"`
+	Right string `yaml:"right"`
+}
+
+type NeighbourhoodConfig struct {
+	Of   string `yaml:"of"`
+	Hops int    `yaml:"hops"`
+	// SizeLimit and Concurrency override defaults of didset.FollowNeighbourhood.
+	SizeLimit   int `yaml:"size_limit"`
+	Concurrency int `yaml:"concurrency"`
+}
+
+// ThresholdConfig selects DIDs for which the total weight of sets
+// they are members of is at least Min.
+type ThresholdConfig struct {
+	Min  float64  `yaml:"min"`
+	Sets []string `yaml:"sets"`
+	// Weights of individual sets. Sets not listed here have weight 1.
+	Weights map[string]float64 `yaml:"weights"`
+}
+
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %q: %w", path, err)
+	}
+	cfg, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func Parse(b []byte) (*Config, error) {
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// kind returns the name of the set kind, or an error if not exactly one is specified.
+func (c *SetConfig) kind() (string, error) {
+	kinds := []string{}
+	add := func(set bool, name string) {
+		if set {
+			kinds = append(kinds, name)
+		}
+	}
+	add(c.FollowersOf != "", "followers_of")
+	add(c.FollowsOf != "", "follows_of")
+	add(c.FollowRecordsOf != "", "follow_records_of")
+	add(c.MutualsOf != "", "mutuals_of")
+	add(c.FollowNeighbourhood != nil, "follow_neighbourhood")
+	add(c.BlockedBy != "", "blocked_by")
+	add(c.BlockedUsers, "blocked_users")
+	add(c.MuteList != "", "mute_list")
+	add(c.List != "", "list")
+	add(c.LikersOf != "", "likers_of")
+	add(c.RepostersOf != "", "reposters_of")
+	add(c.QuotersOf != "", "quoters_of")
+	add(c.ThreadParticipants != "", "thread_participants")
+	add(c.LabeledBy != "", "labeled_by")
+	add(c.Const != nil, "const")
+	add(c.File != "", "file")
+	add(c.Union != nil, "union")
+	add(c.Intersection != nil, "intersection")
+	add(c.Difference != nil, "difference")
+	add(c.Threshold != nil, "threshold")
+
+	switch len(kinds) {
+	case 0:
+		return "", fmt.Errorf("set kind is not specified")
+	case 1:
+		return kinds[0], nil
+	default:
+		return "", fmt.Errorf("only one set kind can be specified, got %s", strings.Join(kinds, ", "))
+	}
+}
+
+// deps returns names of the sets referenced by this one.
+func (c *SetConfig) deps() []string {
+	r := []string{}
+	r = append(r, c.Union...)
+	r = append(r, c.Intersection...)
+	if c.Difference != nil {
+		r = append(r, c.Difference.Left, c.Difference.Right)
+	}
+	if c.Threshold != nil {
+		r = append(r, c.Threshold.Sets...)
+	}
+	return r
+}
+
+// Validate checks that every set has exactly one kind, all references
+// point to existing sets, and there are no cycles.
+func (c *Config) Validate() error {
+	for _, name := range c.names() {
+		set := c.Sets[name]
+		if set == nil {
+			return fmt.Errorf("set %q: empty definition", name)
+		}
+		kind, err := set.kind()
+		if err != nil {
+			return fmt.Errorf("set %q: %w", name, err)
+		}
+		// File sets are never cached, refresh is their polling interval.
+		if kind == "file" && (set.MaxStaleness > 0 || set.SnapshotFile != "") {
+			return fmt.Errorf("set %q: max_staleness and snapshot_file are not supported for file sets", name)
+		}
+		switch set.ListSource {
+		case "", "appview", "records":
+		default:
+			return fmt.Errorf("set %q: unknown list source %q", name, set.ListSource)
+		}
+		if set.LabeledBy != "" && (len(set.Labels) == 0 || set.LabelerHost == "") {
+			return fmt.Errorf("set %q: labeled_by requires both labels and labeler_host", name)
+		}
+		if set.Difference != nil && (set.Difference.Left == "" || set.Difference.Right == "") {
+			return fmt.Errorf("set %q: difference requires both left and right", name)
+		}
+		if set.FollowNeighbourhood != nil && (set.FollowNeighbourhood.Of == "" || set.FollowNeighbourhood.Hops < 1) {
+			return fmt.Errorf("set %q: follow_neighbourhood requires an account and a positive number of hops", name)
+		}
+		if set.Threshold != nil {
+			if len(set.Threshold.Sets) == 0 {
+				return fmt.Errorf("set %q: threshold requires at least one set", name)
+			}
+			for dep := range set.Threshold.Weights {
+				if !slices.Contains(set.Threshold.Sets, dep) {
+					return fmt.Errorf("set %q: weight is specified for %q, which is not in the list of sets", name, dep)
+				}
+			}
+		}
+		for _, dep := range set.deps() {
+			if _, ok := c.Sets[dep]; !ok {
+				return fmt.Errorf("set %q: references unknown set %q", name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		path = append(path, name)
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("cycle detected: %s", strings.Join(path, " -> "))
+		}
+		state[name] = visiting
+		for _, dep := range c.Sets[name].deps() {
+			if err := visit(dep, path); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, name := range c.names() {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) names() []string {
+	r := make([]string, 0, len(c.Sets))
+	for name := range c.Sets {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Compile instantiates all sets described in the config. Background
+// refreshes of cached sets are stopped when ctx is done.
+func (c *Config) Compile(ctx context.Context, client *xrpc.Client) (map[string]didset.QueryableDIDSet, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := &builder{ctx: ctx, client: client, cfg: c, sets: map[string]didset.QueryableDIDSet{}}
+	for _, name := range c.names() {
+		if _, err := b.build(name); err != nil {
+			return nil, err
+		}
+	}
+	return b.sets, nil
+}
+
+// CompileSet is like Compile, but only instantiates the named set and
+// the sets it depends on.
+func (c *Config) CompileSet(ctx context.Context, client *xrpc.Client, name string) (didset.QueryableDIDSet, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if _, ok := c.Sets[name]; !ok {
+		return nil, fmt.Errorf("set %q is not defined", name)
+	}
+
+	b := &builder{ctx: ctx, client: client, cfg: c, sets: map[string]didset.QueryableDIDSet{}}
+	return b.build(name)
+}
+
+type builder struct {
+	ctx    context.Context
+	client *xrpc.Client
+	cfg    *Config
+	sets   map[string]didset.QueryableDIDSet
+}
+
+func (b *builder) build(name string) (didset.QueryableDIDSet, error) {
+	if r, ok := b.sets[name]; ok {
+		return r, nil
+	}
+
+	set := b.cfg.Sets[name]
+	kind, err := set.kind()
+	if err != nil {
+		return nil, fmt.Errorf("set %q: %w", name, err)
+	}
+
+	refs := func(names []string) ([]didset.DIDSet, error) {
+		r := []didset.DIDSet{}
+		for _, n := range names {
+			s, err := b.build(n)
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, s)
+		}
+		return r, nil
+	}
+
+	var source didset.DIDSet
+	remote := true
+	switch kind {
+	case "followers_of":
+		source = didset.FollowersOf(b.client, set.FollowersOf)
+	case "follows_of":
+		source = didset.FollowsOf(b.client, set.FollowsOf)
+	case "follow_records_of":
+		source = didset.FollowRecordsOf(b.client, set.FollowRecordsOf)
+	case "mutuals_of":
+		source = didset.MutualsOf(b.client, set.MutualsOf)
+	case "follow_neighbourhood":
+		nb := set.FollowNeighbourhood
+		opts := []didset.NeighbourhoodOption{}
+		if nb.SizeLimit > 0 {
+			opts = append(opts, didset.WithSizeLimit(nb.SizeLimit))
+		}
+		if nb.Concurrency > 0 {
+			opts = append(opts, didset.WithConcurrency(nb.Concurrency))
+		}
+		source = didset.FollowNeighbourhood(b.client, nb.Of, nb.Hops, opts...)
+	case "blocked_by":
+		source = didset.BlockedBy(b.client, set.BlockedBy)
+	case "blocked_users":
+		source = didset.BlockedUsers(b.client)
+	case "mute_list":
+		source = didset.MuteList(b.client, set.MuteList)
+	case "list":
+		listSource := didset.ListFromAppView
+		if set.ListSource == "records" {
+			listSource = didset.ListFromRecords
+		}
+		source = didset.List(b.client, set.List, listSource)
+	case "likers_of":
+		source = didset.LikersOf(b.client, set.LikersOf)
+	case "reposters_of":
+		source = didset.RepostersOf(b.client, set.RepostersOf)
+	case "quoters_of":
+		source = didset.QuotersOf(b.client, set.QuotersOf)
+	case "thread_participants":
+		source = didset.ThreadParticipants(b.client, set.ThreadParticipants)
+	case "labeled_by":
+		host := set.LabelerHost
+		if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+			host = "https://" + host
+		}
+		source = didset.LabeledAccounts(&xrpc.Client{Host: host}, set.LabeledBy, set.Labels...)
+	case "file":
+		poll := set.Refresh
+		if poll == 0 {
+			poll = time.Minute
+		}
+		var client *xrpc.Client
+		if set.ResolveHandles {
+			client = b.client
+		}
+		r := didset.Annotate(name, didset.FromFile(b.ctx, poll, set.File, client))
+		b.sets[name] = r
+		return r, nil
+	case "const":
+		remote = false
+		source = didset.Annotate(name, didset.Const(set.Const...))
+	case "union":
+		remote = false
+		sets, err := refs(set.Union)
+		if err != nil {
+			return nil, err
+		}
+		source = didset.Union(sets...)
+	case "intersection":
+		remote = false
+		sets, err := refs(set.Intersection)
+		if err != nil {
+			return nil, err
+		}
+		source = didset.Intersection(sets...)
+	case "difference":
+		remote = false
+		sets, err := refs([]string{set.Difference.Left, set.Difference.Right})
+		if err != nil {
+			return nil, err
+		}
+		source = didset.Difference(sets[0], sets[1])
+	case "threshold":
+		remote = false
+		sets, err := refs(set.Threshold.Sets)
+		if err != nil {
+			return nil, err
+		}
+		weighted := []didset.Weighted{}
+		for i, s := range sets {
+			weight, ok := set.Threshold.Weights[set.Threshold.Sets[i]]
+			if !ok {
+				weight = 1
+			}
+			weighted = append(weighted, didset.Weighted{Set: s, Weight: weight})
+		}
+		source = didset.WeightedThreshold(set.Threshold.Min, weighted...)
+	default:
+		return nil, fmt.Errorf("set %q: unsupported kind %q", name, kind)
+	}
+
+	refresh := set.Refresh
+	if refresh == 0 && remote {
+		refresh = b.cfg.Refresh
+		if refresh == 0 {
+			refresh = DefaultRefresh
+		}
+	}
+
+	var r didset.QueryableDIDSet
+	if refresh > 0 {
+		opts := []didset.CacheOption{}
+		if set.MaxStaleness > 0 {
+			opts = append(opts, didset.WithMaxStaleness(set.MaxStaleness))
+		}
+		if set.SnapshotFile != "" {
+			opts = append(opts, didset.WithSnapshotFile(set.SnapshotFile))
+		}
+		// Caching loses annotations of the source, so the cached set
+		// is annotated with its own name.
+		r = didset.Annotate(name, didset.Cached(b.ctx, refresh, source, opts...))
+	} else {
+		q, ok := source.(didset.QueryableDIDSet)
+		if !ok {
+			return nil, fmt.Errorf("set %q: refresh interval is required", name)
+		}
+		r = q
+	}
+
+	b.sets[name] = r
+	return r, nil
+}
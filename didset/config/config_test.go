@@ -0,0 +1,247 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/didset"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: `
+refresh: 30m
+sets:
+  a: {followers_of: did:plc:a}
+  b: {const: [did:plc:b]}
+  c: {union: [a, b]}
+  d: {difference: {left: c, right: b}, refresh: 1m}
+`,
+		},
+		{
+			name:   "JSON",
+			config: `{"refresh": "30m", "sets": {"a": {"const": ["did:plc:a"]}, "b": {"union": ["a"]}}}`,
+		},
+		{
+			name: "cycle",
+			config: `
+sets:
+  a: {union: [b]}
+  b: {intersection: [c]}
+  c: {difference: {left: a, right: a}}
+`,
+			wantErr: "cycle detected: a -> b -> c -> a",
+		},
+		{
+			name:    "self reference",
+			config:  `sets: {a: {union: [a]}}`,
+			wantErr: "cycle detected: a -> a",
+		},
+		{
+			name:    "unknown reference",
+			config:  `sets: {a: {union: [b]}}`,
+			wantErr: `set "a": references unknown set "b"`,
+		},
+		{
+			name:    "unknown threshold reference",
+			config:  `sets: {a: {threshold: {min: 1, sets: [b]}}}`,
+			wantErr: `set "a": references unknown set "b"`,
+		},
+		{
+			name:    "multiple kinds",
+			config:  `sets: {a: {followers_of: did:plc:a, follows_of: did:plc:a}}`,
+			wantErr: `set "a": only one set kind can be specified, got followers_of, follows_of`,
+		},
+		{
+			name:    "no kind",
+			config:  `sets: {a: {refresh: 1m}}`,
+			wantErr: `set "a": set kind is not specified`,
+		},
+		{
+			name:    "file with max staleness",
+			config:  `sets: {a: {file: dids.txt, max_staleness: 1h}}`,
+			wantErr: `set "a": max_staleness and snapshot_file are not supported for file sets`,
+		},
+		{
+			name:    "file with snapshot",
+			config:  `sets: {a: {file: dids.txt, snapshot_file: a.json}}`,
+			wantErr: `set "a": max_staleness and snapshot_file are not supported for file sets`,
+		},
+		{
+			name:    "unknown field",
+			config:  `sets: {a: {followers: did:plc:a}}`,
+			wantErr: "field followers not found",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tc.config))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if cfg.Refresh != 30*time.Minute {
+					t.Errorf("got refresh %s, want 30m", cfg.Refresh)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("got error %q, want it to contain %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// followersServer responds to every getFollowers request with did:plc:a
+// and counts the requests.
+func followersServer(requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/xrpc/app.bsky.graph.getFollowers" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"subject":   map[string]any{"did": "did:plc:owner", "handle": "owner.test"},
+			"followers": []any{map[string]any{"did": "did:plc:a", "handle": "a.test"}},
+		})
+	}))
+}
+
+func TestCompileSharesCache(t *testing.T) {
+	var requests atomic.Int32
+	srv := followersServer(&requests)
+	defer srv.Close()
+
+	cfg, err := Parse([]byte(`
+sets:
+  followers: {followers_of: did:plc:owner}
+  others: {const: [did:plc:b]}
+  all: {union: [followers, others]}
+  both: {intersection: [followers, all]}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sets, err := cfg.Compile(ctx, &xrpc.Client{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("Compile: %s", err)
+	}
+
+	want := map[string][]string{
+		"followers": {"did:plc:a"},
+		"others":    {"did:plc:b"},
+		"all":       {"did:plc:a", "did:plc:b"},
+		"both":      {"did:plc:a"},
+	}
+	for name, dids := range want {
+		got, err := sets[name].GetDIDs(ctx)
+		if err != nil {
+			t.Fatalf("%s: GetDIDs: %s", name, err)
+		}
+		if len(got) != len(dids) {
+			t.Errorf("%s: got %v, want %v", name, got, dids)
+		}
+		for _, did := range dids {
+			if !got[did] {
+				t.Errorf("%s: got %v, want %v", name, got, dids)
+			}
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestFileSetsAreAnnotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	if err := os.WriteFile(path, []byte("did:plc:a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Parse([]byte(`
+sets:
+  allowlist: {file: ` + path + `}
+  all: {union: [allowlist]}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sets, err := cfg.Compile(ctx, nil)
+	if err != nil {
+		t.Fatalf("Compile: %s", err)
+	}
+	sources, ok, err := didset.Explain(ctx, sets["all"], "did:plc:a")
+	if err != nil {
+		t.Fatalf("Explain: %s", err)
+	}
+	if !ok || len(sources) != 1 || sources[0] != "allowlist" {
+		t.Errorf("got sources %v (member: %v), want [allowlist]", sources, ok)
+	}
+}
+
+func TestCompileSetSkipsUnrelatedSets(t *testing.T) {
+	var requests atomic.Int32
+	srv := followersServer(&requests)
+	defer srv.Close()
+
+	cfg, err := Parse([]byte(`
+sets:
+  followers: {followers_of: did:plc:owner}
+  others: {const: [did:plc:b]}
+  all: {union: [others]}
+`))
+	if err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	set, err := cfg.CompileSet(ctx, &xrpc.Client{Host: srv.URL}, "all")
+	if err != nil {
+		t.Fatalf("CompileSet: %s", err)
+	}
+	got, err := set.GetDIDs(ctx)
+	if err != nil {
+		t.Fatalf("GetDIDs: %s", err)
+	}
+	if len(got) != 1 || !got["did:plc:b"] {
+		t.Errorf("got %v, want [did:plc:b]", got)
+	}
+
+	// Give the background refresh a chance to run, if it was started.
+	time.Sleep(50 * time.Millisecond)
+	if n := requests.Load(); n != 0 {
+		t.Errorf("got %d requests, want 0", n)
+	}
+
+	if _, err := cfg.CompileSet(ctx, nil, "missing"); err == nil {
+		t.Errorf("expected an error for an undefined set")
+	}
+}
@@ -0,0 +1,71 @@
+package didset
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// Diff describes the changes between two versions of a set.
+type Diff struct {
+	Added   StringSet
+	Removed StringSet
+}
+
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// ComputeDiff returns DIDs that are present only in new (Added)
+// and only in old (Removed).
+func ComputeDiff(old StringSet, new StringSet) Diff {
+	r := Diff{Added: StringSet{}, Removed: StringSet{}}
+	for did := range new {
+		if !old[did] {
+			r.Added[did] = true
+		}
+	}
+	for did := range old {
+		if !new[did] {
+			r.Removed[did] = true
+		}
+	}
+	return r
+}
+
+// Watch subscribes to changes of the set and invokes the callbacks for
+// every added or removed DID. Either of the callbacks can be nil.
+// Errors returned by the callbacks are logged. Blocks until ctx is done.
+func Watch(ctx context.Context, set CachedDIDSet, onAdded func(ctx context.Context, did string) error, onRemoved func(ctx context.Context, did string) error) error {
+	log := zerolog.Ctx(ctx).With().Str("module", "didset").Logger()
+	ctx = log.WithContext(ctx)
+
+	ch := set.Subscribe(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case diff, ok := <-ch:
+			if !ok {
+				if err := set.LastError(); err != nil {
+					return err
+				}
+				return ctx.Err()
+			}
+			if onAdded != nil {
+				for did := range diff.Added {
+					if err := onAdded(ctx, did); err != nil {
+						log.Error().Err(err).Msgf("Failed to process addition of %q", did)
+					}
+				}
+			}
+			if onRemoved != nil {
+				for did := range diff.Removed {
+					if err := onRemoved(ctx, did); err != nil {
+						log.Error().Err(err).Msgf("Failed to process removal of %q", did)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package didset
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// LineError describes a problem with a single line of a file.
+type LineError struct {
+	File string
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %q: %s", e.File, e.Line, e.Text, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ResolveError is wrapped by LineError when a handle couldn't be resolved
+// because of a network or server error. Unlike other line errors, it is
+// likely to go away without any changes to the file.
+type ResolveError struct {
+	Err error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("resolving handle: %s", e.Err)
+}
+
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// ReadFile reads DIDs from a file, one per line. Empty lines and everything
+// after "#" are ignored. If path is a directory, all non-hidden regular files
+// in it are read. If client is not nil, lines that don't start with "did:"
+// are treated as handles and resolved, otherwise they are reported as errors.
+//
+// Invalid lines are skipped, and the returned error (if any) wraps one
+// *LineError for each of them. Callers that want to use the valid entries
+// anyway can check the error with errors.As.
+// Handles that couldn't be resolved because of a temporary error are reported
+// as a *LineError wrapping *ResolveError.
+func ReadFile(ctx context.Context, path string, client *xrpc.Client) (StringSet, error) {
+	var resolve resolveFunc
+	if client != nil {
+		resolve = func(ctx context.Context, handle string) (string, error) {
+			return resolveHandle(ctx, client, handle)
+		}
+	}
+	return readFiles(ctx, path, resolve)
+}
+
+// resolveFunc returns the DID of the handle.
+type resolveFunc func(ctx context.Context, handle string) (string, error)
+
+// readFiles implements ReadFile. Handles are reported as errors if resolve is nil.
+func readFiles(ctx context.Context, path string, resolve resolveFunc) (StringSet, error) {
+	files, err := listFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := StringSet{}
+	errs := []error{}
+	for _, f := range files {
+		if err := readDIDFile(ctx, f, resolve, r, &errs); err != nil {
+			return nil, err
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+func listFiles(path string) ([]string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	r := []string{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || !e.Type().IsRegular() {
+			continue
+		}
+		r = append(r, filepath.Join(path, e.Name()))
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
+func readDIDFile(ctx context.Context, path string, resolve resolveFunc, r StringSet, errs *[]error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		did, err := parseDIDLine(ctx, text, resolve)
+		if err != nil {
+			*errs = append(*errs, &LineError{File: path, Line: n, Text: text, Err: err})
+			continue
+		}
+		r[did] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading %q: %w", path, err)
+	}
+	return nil
+}
+
+func parseDIDLine(ctx context.Context, text string, resolve resolveFunc) (string, error) {
+	if strings.ContainsAny(text, " \t") {
+		return "", fmt.Errorf("unexpected whitespace")
+	}
+	if strings.HasPrefix(text, "did:") {
+		parts := strings.SplitN(text, ":", 3)
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			return "", fmt.Errorf("malformed DID")
+		}
+		return text, nil
+	}
+	if resolve == nil {
+		return "", fmt.Errorf("not a DID")
+	}
+
+	handle := strings.TrimPrefix(text, "@")
+	if !strings.Contains(handle, ".") {
+		return "", fmt.Errorf("neither a DID nor a handle")
+	}
+	return resolve(ctx, handle)
+}
+
+// resolveHandle returns the DID of the handle, or *ResolveError if the handle
+// couldn't be resolved because of a temporary problem.
+func resolveHandle(ctx context.Context, client *xrpc.Client, handle string) (string, error) {
+	resp, err := comatproto.IdentityResolveHandle(ctx, client, handle)
+	if err != nil {
+		var xrpcErr *xrpc.Error
+		if errors.As(err, &xrpcErr) && xrpcErr.StatusCode == http.StatusBadRequest {
+			// The handle doesn't exist.
+			return "", fmt.Errorf("resolving handle: %w", err)
+		}
+		return "", &ResolveError{Err: err}
+	}
+	return resp.Did, nil
+}
+
+type fileBacked struct {
+	path   string
+	client *xrpc.Client
+
+	mu             sync.Mutex
+	entries        StringSet
+	modTime        time.Time
+	waitUntilReady chan struct{}
+	readyOnce      sync.Once
+	err            error
+
+	// resolved maps handles found in the file to their DIDs, so that they
+	// are not resolved again on every reload. Handles removed from the file
+	// are forgotten. Only accessed by the reload goroutine.
+	resolved map[string]string
+}
+
+// resolve returns the DID of the handle from the previous reloads if it
+// was resolved already, and resolves it otherwise. All successfully resolved
+// handles are recorded in seen.
+func (f *fileBacked) resolve(seen map[string]string) resolveFunc {
+	return func(ctx context.Context, handle string) (string, error) {
+		if did, ok := f.resolved[handle]; ok {
+			seen[handle] = did
+			return did, nil
+		}
+		did, err := resolveHandle(ctx, f.client, handle)
+		if err != nil {
+			return "", err
+		}
+		seen[handle] = did
+		return did, nil
+	}
+}
+
+// currentModTime returns the latest modification time among the files
+// and, for a directory, of the directory itself (to notice added or removed files).
+func (f *fileBacked) currentModTime() (time.Time, error) {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r := st.ModTime()
+	files, err := listFiles(f.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, file := range files {
+		st, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(r) {
+			r = st.ModTime()
+		}
+	}
+	return r, nil
+}
+
+func (f *fileBacked) reload(ctx context.Context) {
+	log := zerolog.Ctx(ctx)
+
+	mtime, err := f.currentModTime()
+	if err != nil {
+		log.Warn().Err(err).Msgf("Failed to check %q for changes", f.path)
+		f.mu.Lock()
+		f.err = err
+		f.entries = nil
+		f.mu.Unlock()
+		f.readyOnce.Do(func() { close(f.waitUntilReady) })
+		return
+	}
+	f.mu.Lock()
+	unchanged := mtime.Equal(f.modTime) && f.entries != nil
+	f.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	var resolve resolveFunc
+	seen := map[string]string{}
+	if f.client != nil {
+		resolve = f.resolve(seen)
+	}
+	set, err := readFiles(ctx, f.path, resolve)
+	var lineErr *LineError
+	retry := false
+	switch {
+	case err == nil:
+	case errors.As(err, &lineErr):
+		// Keep the valid entries, but report all the problems.
+		for _, e := range flattenErrors(err) {
+			var resolveErr *ResolveError
+			if errors.As(e, &resolveErr) {
+				retry = true
+				log.Warn().Err(e).Msgf("Failed to resolve a handle in %q, will retry on the next poll", f.path)
+				continue
+			}
+			log.Warn().Err(e).Msgf("Invalid entry in %q", f.path)
+		}
+	default:
+		log.Warn().Err(err).Msgf("Failed to read %q", f.path)
+		f.mu.Lock()
+		f.err = err
+		f.mu.Unlock()
+		// Unblock queries, so that they can return the error.
+		f.readyOnce.Do(func() { close(f.waitUntilReady) })
+		return
+	}
+
+	f.resolved = seen
+	f.mu.Lock()
+	f.entries = set
+	if !retry {
+		f.modTime = mtime
+	}
+	f.err = nil
+	f.mu.Unlock()
+	f.readyOnce.Do(func() { close(f.waitUntilReady) })
+	log.Debug().Msgf("Loaded %d dids from %q", len(set), f.path)
+}
+
+func flattenErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func (f *fileBacked) run(ctx context.Context, poll time.Duration) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "file").
+		Str("path", f.path).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	f.reload(ctx)
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			f.reload(ctx)
+		case <-ctx.Done():
+			f.mu.Lock()
+			f.err = fmt.Errorf("context of the background goroutine is done: %w", ctx.Err())
+			f.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (f *fileBacked) GetDIDs(ctx context.Context) (StringSet, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.waitUntilReady:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.entries.Clone(), nil
+}
+
+func (f *fileBacked) Contains(ctx context.Context, did string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-f.waitUntilReady:
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.entries[did], nil
+}
+
+// FromFile returns a set of DIDs listed in a file or a directory (see
+// ReadFile for the format), reloading it when its modification time changes.
+// Invalid lines are logged and skipped. Handles are resolved once and their
+// DIDs are reused on later reloads for as long as they stay in the file.
+// Handles that couldn't be resolved because of a temporary error are retried
+// on the next poll, even if the file hasn't changed. If the file can't be read
+// at all, queries return an error until it's fixed.
+// client is optional and is used for resolving handles.
+func FromFile(ctx context.Context, poll time.Duration, path string, client *xrpc.Client) QueryableDIDSet {
+	r := &fileBacked{
+		path:           path,
+		client:         client,
+		waitUntilReady: make(chan struct{}),
+	}
+	go r.run(ctx, poll)
+	return r
+}
@@ -0,0 +1,105 @@
+package didset
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// fakeResolver resolves "<name>.test" to "did:plc:<name>", failing with
+// a server error for handles listed in down, and counts the requests.
+type fakeResolver struct {
+	mu       sync.Mutex
+	down     map[string]bool
+	requests map[string]int
+}
+
+func (s *fakeResolver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/xrpc/com.atproto.identity.resolveHandle" {
+		http.NotFound(w, r)
+		return
+	}
+	handle := r.URL.Query().Get("handle")
+
+	s.mu.Lock()
+	s.requests[handle]++
+	down := s.down[handle]
+	s.mu.Unlock()
+
+	if down {
+		http.Error(w, `{"error":"InternalServerError"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"did": "did:plc:" + handle[:len(handle)-len(".test")]})
+}
+
+func (s *fakeResolver) setDown(handle string, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down[handle] = down
+}
+
+func (s *fakeResolver) count(handle string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[handle]
+}
+
+func TestFromFileReusesResolvedHandles(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resolver := &fakeResolver{down: map[string]bool{"bob.test": true}, requests: map[string]int{}}
+	srv := httptest.NewServer(resolver)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "dids.txt")
+	if err := os.WriteFile(path, []byte("alice.test\nbob.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The default HTTP client retries server errors with backoff.
+	set := FromFile(ctx, 10*time.Millisecond, path, &xrpc.Client{Host: srv.URL, Client: srv.Client()})
+
+	has := func(did string) bool {
+		r, err := set.Contains(ctx, did)
+		if err != nil {
+			t.Fatalf("Contains(%q): %s", did, err)
+		}
+		return r
+	}
+
+	// Failed handles are retried on every poll, but resolved ones are not.
+	eventually(t, 5*time.Second, func() bool { return resolver.count("bob.test") >= 3 })
+	if !has("did:plc:alice") {
+		t.Errorf("resolved handle is missing from the set")
+	}
+	if n := resolver.count("alice.test"); n != 1 {
+		t.Errorf("resolved handle was resolved %d times, want 1", n)
+	}
+
+	resolver.setDown("bob.test", false)
+	eventually(t, 5*time.Second, func() bool { return has("did:plc:bob") })
+
+	// Changes to the file don't cause handles that are still there to be resolved again.
+	if err := os.WriteFile(path, []byte("alice.test\nbob.test\ndid:plc:carol\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 5*time.Second, func() bool { return has("did:plc:carol") })
+	if n := resolver.count("alice.test"); n != 1 {
+		t.Errorf("resolved handle was resolved %d times, want 1", n)
+	}
+	if !has("did:plc:alice") || !has("did:plc:bob") {
+		t.Errorf("resolved handles are missing from the set after reload")
+	}
+}
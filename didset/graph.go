@@ -0,0 +1,227 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+type mutuals struct {
+	client *xrpc.Client
+	did    string
+}
+
+// MutualsOf returns accounts that both follow and are followed by the given account.
+func MutualsOf(authclient *xrpc.Client, did string) DIDSet {
+	return &mutuals{client: authclient, did: did}
+}
+
+func (m *mutuals) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "mutuals").
+		Str("mutuals_of", m.did).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	// Skip fetching the lists entirely if one of them is empty.
+	profile, err := bsky.ActorGetProfile(ctx, m.client, m.did)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.actor.getProfile: %w", err)
+	}
+	if profile.FollowsCount != nil && *profile.FollowsCount == 0 ||
+		profile.FollowersCount != nil && *profile.FollowersCount == 0 {
+		return StringSet{}, nil
+	}
+
+	var follows, followers StringSet
+	var followsErr, followersErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		follows, followsErr = FollowsOf(m.client, m.did).GetDIDs(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		followers, followersErr = FollowersOf(m.client, m.did).GetDIDs(ctx)
+	}()
+	wg.Wait()
+	if followsErr != nil {
+		return nil, followsErr
+	}
+	if followersErr != nil {
+		return nil, followersErr
+	}
+
+	if len(followers) < len(follows) {
+		follows, followers = followers, follows
+	}
+	r := StringSet{}
+	for did := range follows {
+		if followers[did] {
+			r[did] = true
+		}
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+type NeighbourhoodOption func(*neighbourhood)
+
+// WithSizeLimit stops the traversal once the set reaches the given size.
+// Accounts closer to the starting one are always added first.
+// Default is 100000.
+func WithSizeLimit(n int) NeighbourhoodOption {
+	return func(nb *neighbourhood) {
+		nb.sizeLimit = n
+	}
+}
+
+// WithConcurrency sets the number of accounts whose follows are fetched
+// in parallel. Default is 8.
+func WithConcurrency(n int) NeighbourhoodOption {
+	return func(nb *neighbourhood) {
+		nb.concurrency = n
+	}
+}
+
+type neighbourhood struct {
+	client      *xrpc.Client
+	did         string
+	hops        int
+	sizeLimit   int
+	concurrency int
+}
+
+// FollowNeighbourhood returns accounts reachable from the given one by
+// following at most hops follow edges. With hops=1 it is the same as FollowsOf,
+// and hops=2 adds follows of follows. The starting account is not included.
+func FollowNeighbourhood(authclient *xrpc.Client, did string, hops int, opts ...NeighbourhoodOption) DIDSet {
+	r := &neighbourhood{
+		client:      authclient,
+		did:         did,
+		hops:        hops,
+		sizeLimit:   100000,
+		concurrency: 8,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (n *neighbourhood) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "neighbourhood").
+		Str("neighbourhood_of", n.did).
+		Int("hops", n.hops).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	r := StringSet{}
+	visited := StringSet{n.did: true}
+	frontier := []string{n.did}
+	full := func() bool {
+		return n.sizeLimit > 0 && len(r) >= n.sizeLimit
+	}
+
+	for hop := 1; hop <= n.hops && len(frontier) > 0 && !full(); hop++ {
+		next := []string{}
+		err := n.expand(ctx, frontier, hop == 1, func(follows StringSet) bool {
+			for did := range follows {
+				if full() {
+					return false
+				}
+				if visited[did] {
+					continue
+				}
+				visited[did] = true
+				r[did] = true
+				next = append(next, did)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Msgf("Hop %d: %d accounts total", hop, len(r))
+		frontier = next
+	}
+	if full() {
+		log.Warn().Msgf("Reached the size limit of %d accounts, the set is truncated", n.sizeLimit)
+	}
+
+	return r, nil
+}
+
+// expand fetches follows of all accounts in the frontier and passes them
+// to add, which is never called concurrently and returns false to stop early.
+// If strict is false, accounts whose follows can't be fetched (e.g., deleted ones)
+// are skipped.
+func (n *neighbourhood) expand(ctx context.Context, frontier []string, strict bool, add func(StringSet) bool) error {
+	concurrency := n.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	stopped := false
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for did := range queue {
+				follows, err := FollowsOf(n.client, did).GetDIDs(ctx)
+				mu.Lock()
+				switch {
+				case stopped:
+				case err == nil:
+					if !add(follows) {
+						stopped = true
+						cancel()
+					}
+				case strict:
+					if firstErr == nil {
+						firstErr = fmt.Errorf("fetching follows of %q: %w", did, err)
+					}
+					cancel()
+				default:
+					zerolog.Ctx(ctx).Warn().Err(err).Str("did", did).Msgf("Failed to fetch follows, skipping")
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+loop:
+	for _, did := range frontier {
+		select {
+		case queue <- did:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if stopped {
+		return nil
+	}
+	return ctx.Err()
+}
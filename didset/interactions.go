@@ -0,0 +1,279 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/bskyurl"
+	"github.com/uabluerail/bsky-tools/pagination"
+)
+
+// resolvePostURI converts anything that bskyurl.DetermineTarget understands
+// into an at:// URI of a post, resolving the handle if needed.
+func resolvePostURI(ctx context.Context, client *xrpc.Client, target string) (string, error) {
+	t, err := bskyurl.DetermineTarget(target)
+	if err != nil {
+		return "", err
+	}
+	post, ok := t.(*bskyurl.Post)
+	if !ok {
+		return "", fmt.Errorf("%q is not a post", target)
+	}
+
+	did := post.Profile
+	if !strings.HasPrefix(did, "did:") {
+		resp, err := comatproto.IdentityResolveHandle(ctx, client, did)
+		if err != nil {
+			return "", fmt.Errorf("resolving handle %q: %w", did, err)
+		}
+		did = resp.Did
+	}
+	return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, post.Rkey), nil
+}
+
+type likers struct {
+	client *xrpc.Client
+	target string
+}
+
+func (l *likers) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "likers").
+		Str("target", l.target).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	uri, err := resolvePostURI(ctx, l.client, l.target)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := pagination.Reduce(
+		func(cursor string) (resp *bsky.FeedGetLikes_Output, nextCursor string, err error) {
+			resp, err = bsky.FeedGetLikes(ctx, l.client, "", cursor, 100, uri)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *bsky.FeedGetLikes_Output, acc StringSet) (StringSet, error) {
+			if acc == nil {
+				acc = make(StringSet)
+			}
+			for _, like := range resp.Likes {
+				if like.Actor != nil {
+					acc[like.Actor.Did] = true
+				}
+			}
+			return acc, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.feed.getLikes: %w", err)
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+// LikersOf returns accounts that liked the post. target can be anything
+// that bskyurl.DetermineTarget understands.
+func LikersOf(authclient *xrpc.Client, target string) DIDSet {
+	return &likers{client: authclient, target: target}
+}
+
+type reposters struct {
+	client *xrpc.Client
+	target string
+}
+
+func (rp *reposters) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "reposters").
+		Str("target", rp.target).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	uri, err := resolvePostURI(ctx, rp.client, rp.target)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := pagination.Reduce(
+		func(cursor string) (resp *bsky.FeedGetRepostedBy_Output, nextCursor string, err error) {
+			resp, err = bsky.FeedGetRepostedBy(ctx, rp.client, "", cursor, 100, uri)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *bsky.FeedGetRepostedBy_Output, acc StringSet) (StringSet, error) {
+			if acc == nil {
+				acc = make(StringSet)
+			}
+			for _, actor := range resp.RepostedBy {
+				acc[actor.Did] = true
+			}
+			return acc, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.feed.getRepostedBy: %w", err)
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+// RepostersOf returns accounts that reposted the post. target can be anything
+// that bskyurl.DetermineTarget understands.
+func RepostersOf(authclient *xrpc.Client, target string) DIDSet {
+	return &reposters{client: authclient, target: target}
+}
+
+// getQuotesOutput is the output of app.bsky.feed.getQuotes, which is
+// missing from the version of indigo we depend on.
+type getQuotesOutput struct {
+	Cursor *string                   `json:"cursor,omitempty"`
+	Posts  []*bsky.FeedDefs_PostView `json:"posts"`
+}
+
+type quoters struct {
+	client *xrpc.Client
+	target string
+}
+
+func (q *quoters) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "quoters").
+		Str("target", q.target).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	uri, err := resolvePostURI(ctx, q.client, q.target)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := pagination.Reduce(
+		func(cursor string) (resp *getQuotesOutput, nextCursor string, err error) {
+			params := map[string]interface{}{
+				"uri":   uri,
+				"limit": 100,
+			}
+			if cursor != "" {
+				params["cursor"] = cursor
+			}
+			resp = &getQuotesOutput{}
+			err = q.client.Do(ctx, xrpc.Query, "", "app.bsky.feed.getQuotes", params, nil, resp)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *getQuotesOutput, acc StringSet) (StringSet, error) {
+			if acc == nil {
+				acc = make(StringSet)
+			}
+			for _, post := range resp.Posts {
+				if post.Author != nil {
+					acc[post.Author.Did] = true
+				}
+			}
+			return acc, nil
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.feed.getQuotes: %w", err)
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+// QuotersOf returns accounts that quoted the post. target can be anything
+// that bskyurl.DetermineTarget understands.
+func QuotersOf(authclient *xrpc.Client, target string) DIDSet {
+	return &quoters{client: authclient, target: target}
+}
+
+type threadParticipants struct {
+	client *xrpc.Client
+	target string
+}
+
+func (t *threadParticipants) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "thread").
+		Str("target", t.target).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	uri, err := resolvePostURI(ctx, t.client, t.target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the root of the thread first.
+	resp, err := bsky.FeedGetPostThread(ctx, t.client, 0, 0, uri)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.feed.getPostThread: %w", err)
+	}
+	if resp.Thread == nil || resp.Thread.FeedDefs_ThreadViewPost == nil {
+		return nil, fmt.Errorf("post %q is not available", uri)
+	}
+	if post := resp.Thread.FeedDefs_ThreadViewPost.Post; post != nil && post.Record != nil {
+		if rec, ok := post.Record.Val.(*bsky.FeedPost); ok && rec.Reply != nil && rec.Reply.Root != nil {
+			uri = rec.Reply.Root.Uri
+		}
+	}
+
+	resp, err = bsky.FeedGetPostThread(ctx, t.client, 1000, 0, uri)
+	if err != nil {
+		return nil, fmt.Errorf("app.bsky.feed.getPostThread: %w", err)
+	}
+	if resp.Thread == nil || resp.Thread.FeedDefs_ThreadViewPost == nil {
+		return nil, fmt.Errorf("thread root %q is not available", uri)
+	}
+
+	r := StringSet{}
+	var walk func(p *bsky.FeedDefs_ThreadViewPost)
+	walk = func(p *bsky.FeedDefs_ThreadViewPost) {
+		if p.Post != nil && p.Post.Author != nil {
+			r[p.Post.Author.Did] = true
+		}
+		for _, reply := range p.Replies {
+			if reply != nil && reply.FeedDefs_ThreadViewPost != nil {
+				walk(reply.FeedDefs_ThreadViewPost)
+			}
+		}
+	}
+	walk(resp.Thread.FeedDefs_ThreadViewPost)
+
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+// ThreadParticipants returns authors of all posts in the thread that
+// contains the given post, starting from its root. target can be anything
+// that bskyurl.DetermineTarget understands.
+func ThreadParticipants(authclient *xrpc.Client, target string) DIDSet {
+	return &threadParticipants{client: authclient, target: target}
+}
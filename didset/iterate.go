@@ -0,0 +1,161 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+)
+
+// IterableDIDSet is implemented by sets that can stream their members
+// without holding all of them in memory at once.
+type IterableDIDSet interface {
+	DIDSet
+	// Iterate calls fn for every member of the set, until it returns false.
+	// To keep memory usage constant, members are not deduplicated, so
+	// the same DID can be passed to fn more than once.
+	Iterate(ctx context.Context, fn func(did string) bool) error
+}
+
+// Iterate calls fn for every member of the set, until it returns false.
+// Sets that don't implement IterableDIDSet are fetched with GetDIDs first.
+func Iterate(ctx context.Context, set DIDSet, fn func(did string) bool) error {
+	if s, ok := set.(IterableDIDSet); ok {
+		return s.Iterate(ctx, fn)
+	}
+	dids, err := set.GetDIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for did := range dids {
+		if !fn(did) {
+			break
+		}
+	}
+	return nil
+}
+
+// collect materializes the output of an Iterate method.
+func collect(ctx context.Context, iterate func(ctx context.Context, fn func(did string) bool) error) (StringSet, error) {
+	r := StringSet{}
+	err := iterate(ctx, func(did string) bool {
+		r[did] = true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (set StringSet) Iterate(ctx context.Context, fn func(did string) bool) error {
+	for did := range set {
+		if !fn(did) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *CompactSet) Iterate(ctx context.Context, fn func(did string) bool) error {
+	s.ForEach(fn)
+	return nil
+}
+
+func (c *caching) Iterate(ctx context.Context, fn func(did string) bool) error {
+	entries, err := c.GetCompact(ctx)
+	if err != nil {
+		return err
+	}
+	entries.ForEach(fn)
+	return nil
+}
+
+func (a *annotated) Iterate(ctx context.Context, fn func(did string) bool) error {
+	return Iterate(ctx, a.set, fn)
+}
+
+// Iterate streams members of every set in turn. DIDs that are
+// in more than one set are passed to fn multiple times.
+func (u *union) Iterate(ctx context.Context, fn func(did string) bool) error {
+	stopped := false
+	for i, s := range u.sets {
+		err := Iterate(ctx, s, func(did string) bool {
+			stopped = !fn(did)
+			return !stopped
+		})
+		if err != nil {
+			return fmt.Errorf("evaluating %d'th set of union: %w", i, err)
+		}
+		if stopped {
+			break
+		}
+	}
+	return nil
+}
+
+// asQueryable returns the set itself if it implements QueryableDIDSet,
+// and fetches all of its members otherwise, so that checking many DIDs
+// doesn't fetch the whole set every time. Set operations implement
+// QueryableDIDSet only if all of their operands do, so a queryable set
+// never fetches anything in full to answer Contains.
+func asQueryable(ctx context.Context, set DIDSet) (QueryableDIDSet, error) {
+	if q, ok := set.(QueryableDIDSet); ok {
+		return q, nil
+	}
+	return GetCompact(ctx, set)
+}
+
+// Iterate streams the left side, checking every DID against the right side.
+func (d *difference) Iterate(ctx context.Context, fn func(did string) bool) error {
+	right, err := asQueryable(ctx, d.right)
+	if err != nil {
+		return fmt.Errorf("evaluating right side of a difference: %w", err)
+	}
+
+	var checkErr error
+	err = Iterate(ctx, d.left, func(did string) bool {
+		excluded, err := right.Contains(ctx, did)
+		if err != nil {
+			checkErr = fmt.Errorf("evaluating right side of a difference: %w", err)
+			return false
+		}
+		return excluded || fn(did)
+	})
+	if err != nil {
+		return fmt.Errorf("evaluating left side of a difference: %w", err)
+	}
+	return checkErr
+}
+
+// Iterate streams the first set, checking every DID against the rest.
+func (i *intersection) Iterate(ctx context.Context, fn func(did string) bool) error {
+	if len(i.sets) == 0 {
+		return nil
+	}
+	rest := []QueryableDIDSet{}
+	for n, s := range i.sets[1:] {
+		q, err := asQueryable(ctx, s)
+		if err != nil {
+			return fmt.Errorf("evaluating %d'th set of intersection: %w", n+1, err)
+		}
+		rest = append(rest, q)
+	}
+
+	var checkErr error
+	err := Iterate(ctx, i.sets[0], func(did string) bool {
+		for n, s := range rest {
+			r, err := s.Contains(ctx, did)
+			if err != nil {
+				checkErr = fmt.Errorf("evaluating %d'th set of intersection: %w", n+1, err)
+				return false
+			}
+			if !r {
+				return true
+			}
+		}
+		return fn(did)
+	})
+	if err != nil {
+		return fmt.Errorf("evaluating 0'th set of intersection: %w", err)
+	}
+	return checkErr
+}
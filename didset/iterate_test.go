@@ -0,0 +1,55 @@
+package didset
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+// countingSet is a non-queryable set that counts calls to GetDIDs.
+type countingSet struct {
+	set   DIDSet
+	calls *atomic.Int32
+}
+
+func (s countingSet) GetDIDs(ctx context.Context) (StringSet, error) {
+	s.calls.Add(1)
+	return s.set.GetDIDs(ctx)
+}
+
+func TestIterateFetchesOperandsOnce(t *testing.T) {
+	left := Const("did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d")
+
+	tests := []struct {
+		name string
+		set  func(other DIDSet) DIDSet
+		want []string
+	}{
+		{name: "difference", set: func(other DIDSet) DIDSet { return Difference(left, other) },
+			want: []string{"did:plc:a", "did:plc:d"}},
+		{name: "intersection", set: func(other DIDSet) DIDSet { return Intersection(left, other) },
+			want: []string{"did:plc:b", "did:plc:c"}},
+		{name: "nested", set: func(other DIDSet) DIDSet { return Intersection(left, Union(Const(), other)) },
+			want: []string{"did:plc:b", "did:plc:c"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := &atomic.Int32{}
+			other := countingSet{set: Const("did:plc:b", "did:plc:c", "did:plc:e"), calls: calls}
+
+			got, err := collect(context.Background(), func(ctx context.Context, fn func(did string) bool) error {
+				return Iterate(ctx, tc.set(other), fn)
+			})
+			if err != nil {
+				t.Fatalf("Iterate: %s", err)
+			}
+			if diff := compareSets(got, tc.want); diff != "" {
+				t.Errorf("Iterate: %s", diff)
+			}
+			if n := calls.Load(); n != 1 {
+				t.Errorf("non-queryable operand was fetched %d times, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/labelstream"
+	"github.com/uabluerail/bsky-tools/pagination"
+)
+
+type labelKey struct {
+	uri string
+	val string
+}
+
+// labelState keeps the most recent label for each (uri, val) pair.
+type labelState struct {
+	labeler string
+	vals    map[string]bool
+
+	mu     sync.Mutex
+	labels map[labelKey]*labelstream.Label
+}
+
+func newLabelState(labeler string, vals []string) *labelState {
+	r := &labelState{
+		labeler: labeler,
+		vals:    map[string]bool{},
+		labels:  map[labelKey]*labelstream.Label{},
+	}
+	for _, v := range vals {
+		r.vals[v] = true
+	}
+	return r
+}
+
+// relevant returns true for account-level labels from the labeler with
+// one of the values we're interested in.
+func (s *labelState) relevant(label *labelstream.Label) bool {
+	return label.Src == s.labeler && strings.HasPrefix(label.Uri, "did:") && s.vals[label.Val]
+}
+
+func (s *labelState) apply(label *labelstream.Label) {
+	if !s.relevant(label) {
+		return
+	}
+	key := labelKey{uri: label.Uri, val: label.Val}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if prev, ok := s.labels[key]; ok {
+		prevTs, err1 := prev.CreatedAt()
+		ts, err2 := label.CreatedAt()
+		if err1 == nil && err2 == nil && ts.Before(prevTs) {
+			// Out of order update, ignore.
+			return
+		}
+	}
+	s.labels[key] = label
+}
+
+func (s *labelState) members(now time.Time) StringSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := StringSet{}
+	for key, label := range s.labels {
+		if label.IsNegation() || label.ExpiredAt(now) {
+			continue
+		}
+		r[key.uri] = true
+	}
+	return r
+}
+
+func (s *labelState) contains(did string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for val := range s.vals {
+		label, ok := s.labels[labelKey{uri: did, val: val}]
+		if ok && !label.IsNegation() && !label.ExpiredAt(now) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryLabelsOutput struct {
+	Cursor *string              `json:"cursor,omitempty"`
+	Labels []*labelstream.Label `json:"labels"`
+}
+
+// load pages through com.atproto.label.queryLabels and applies all returned labels.
+func (s *labelState) load(ctx context.Context, client *xrpc.Client) error {
+	count, err := pagination.Reduce(
+		func(cursor string) (resp *queryLabelsOutput, nextCursor string, err error) {
+			params := map[string]interface{}{
+				"uriPatterns": []string{"did:*"},
+				"sources":     []string{s.labeler},
+				"limit":       250,
+			}
+			if cursor != "" {
+				params["cursor"] = cursor
+			}
+			resp = &queryLabelsOutput{}
+			err = client.Do(ctx, xrpc.Query, "", "com.atproto.label.queryLabels", params, nil, resp)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *queryLabelsOutput, acc int) (int, error) {
+			for _, label := range resp.Labels {
+				if label != nil {
+					s.apply(label)
+					acc++
+				}
+			}
+			return acc, nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("com.atproto.label.queryLabels: %w", err)
+	}
+	zerolog.Ctx(ctx).Trace().Msgf("Got %d labels", count)
+	return nil
+}
+
+type labeled struct {
+	client  *xrpc.Client
+	labeler string
+	vals    []string
+}
+
+func (l *labeled) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "labeled").
+		Str("labeler", l.labeler).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	// Start from scratch every time, so that labels removed without
+	// a negation (e.g., deleted accounts) are dropped too.
+	state := newLabelState(l.labeler, l.vals)
+	if err := state.load(ctx, l.client); err != nil {
+		return nil, err
+	}
+	r := state.members(time.Now())
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+// LabeledAccounts returns accounts that have any of the given labels applied
+// by the labeler, with negations and expiration taken into account. Every
+// GetDIDs call pages through com.atproto.label.queryLabels, so client.Host
+// must point to the labeler service. Wrap it in Cached for periodic refreshes,
+// or use LabelTracker to follow a label stream instead.
+func LabeledAccounts(client *xrpc.Client, labeler string, vals ...string) DIDSet {
+	return &labeled{client: client, labeler: labeler, vals: vals}
+}
+
+// LabelTracker maintains a set of accounts that have any of the given labels
+// applied by the labeler, using updates from a label stream.
+type LabelTracker struct {
+	state *labelState
+}
+
+func NewLabelTracker(labeler string, vals ...string) *LabelTracker {
+	return &LabelTracker{state: newLabelState(labeler, vals)}
+}
+
+// Load fetches current labels with com.atproto.label.queryLabels. It can be
+// used to populate the set before subscribing to the label stream.
+func (t *LabelTracker) Load(ctx context.Context, client *xrpc.Client) error {
+	return t.state.load(ctx, client)
+}
+
+// Apply updates the set with a single label. It has the signature of
+// labelstream.Action.
+func (t *LabelTracker) Apply(ctx context.Context, label *labelstream.Label) {
+	t.state.apply(label)
+}
+
+// Hook returns a hook that can be added to labelstream.Stream.
+func (t *LabelTracker) Hook() labelstream.Hook {
+	return labelstream.Hook{
+		Predicate: labelstream.AllOf(labelstream.FromSource(t.state.labeler), labelstream.ForAccount()),
+		Action:    t.Apply,
+	}
+}
+
+func (t *LabelTracker) GetDIDs(ctx context.Context) (StringSet, error) {
+	return t.state.members(time.Now()), nil
+}
+
+func (t *LabelTracker) Contains(ctx context.Context, did string) (bool, error) {
+	return t.state.contains(did, time.Now()), nil
+}
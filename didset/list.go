@@ -0,0 +1,199 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/aturl"
+	"github.com/uabluerail/bsky-tools/pagination"
+)
+
+type ListSource int
+
+const (
+	// ListFromAppView fetches list members with app.bsky.graph.getList.
+	// Record keys of list items are not available with this source.
+	ListFromAppView ListSource = iota
+	// ListFromRecords reads app.bsky.graph.listitem records directly from
+	// the repo of the list owner. This also works for lists that are hidden
+	// by the AppView.
+	ListFromRecords
+)
+
+// ListDIDSet is a set of list members.
+type ListDIDSet interface {
+	DIDSet
+	// GetItems returns record keys of app.bsky.graph.listitem records for
+	// each member of the list. An account can be added to a list multiple times,
+	// so there can be more than one record per member. Slices are empty
+	// if the source doesn't provide record keys.
+	GetItems(ctx context.Context) (map[string][]string, error)
+}
+
+type list struct {
+	client *xrpc.Client
+	uri    string
+	source ListSource
+}
+
+// List returns members of the list with the given at:// URI.
+func List(authclient *xrpc.Client, uri string, source ListSource) ListDIDSet {
+	return &list{client: authclient, uri: uri, source: source}
+}
+
+func (l *list) GetDIDs(ctx context.Context) (StringSet, error) {
+	return collect(ctx, l.Iterate)
+}
+
+func (l *list) Iterate(ctx context.Context, fn func(did string) bool) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "list").
+		Str("list_url", l.uri).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	switch l.source {
+	case ListFromAppView:
+		return l.iterateAppView(ctx, fn)
+	case ListFromRecords:
+		owner, err := l.owner()
+		if err != nil {
+			return err
+		}
+		err = recordSubjects(ctx, l.client, owner, "app.bsky.graph.listitem", func(rec *comatproto.RepoListRecords_Record) (string, bool) {
+			item, ok := rec.Value.Val.(*bsky.GraphListitem)
+			if !ok || !sameList(item.List, l.uri, owner) {
+				return "", false
+			}
+			return item.Subject, true
+		}, fn)
+		if err != nil {
+			return fmt.Errorf("listing listitem records: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown list source %d", l.source)
+	}
+}
+
+func (l *list) GetItems(ctx context.Context) (map[string][]string, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "list").
+		Str("list_url", l.uri).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	var r map[string][]string
+	var err error
+	switch l.source {
+	case ListFromAppView:
+		r, err = l.fromAppView(ctx)
+	case ListFromRecords:
+		r, err = l.fromRecords(ctx)
+	default:
+		return nil, fmt.Errorf("unknown list source %d", l.source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+func (l *list) iterateAppView(ctx context.Context, fn func(did string) bool) error {
+	err := pagination.ForEach(
+		func(cursor string) (resp *bsky.GraphGetList_Output, nextCursor string, err error) {
+			resp, err = bsky.GraphGetList(ctx, l.client, cursor, 100, l.uri)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *bsky.GraphGetList_Output) (bool, error) {
+			for _, item := range resp.Items {
+				if item == nil || item.Subject == nil {
+					continue
+				}
+				if !fn(item.Subject.Did) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("app.bsky.graph.getList: %w", err)
+	}
+	return nil
+}
+
+func (l *list) fromAppView(ctx context.Context) (map[string][]string, error) {
+	r := map[string][]string{}
+	err := l.iterateAppView(ctx, func(did string) bool {
+		r[did] = []string{}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (l *list) owner() (string, error) {
+	u, err := aturl.Parse(l.uri)
+	if err != nil {
+		return "", fmt.Errorf("parsing list URI %q: %w", l.uri, err)
+	}
+	if u.Scheme != "at" || u.Host == "" {
+		return "", fmt.Errorf("list URI must be an at:// URI, got %q", l.uri)
+	}
+	return u.Host, nil
+}
+
+func (l *list) fromRecords(ctx context.Context) (map[string][]string, error) {
+	owner, err := l.owner()
+	if err != nil {
+		return nil, err
+	}
+
+	r := map[string][]string{}
+	err = pagination.ListRecords(ctx, l.client, owner, "app.bsky.graph.listitem", func(rec *comatproto.RepoListRecords_Record) bool {
+		item, ok := rec.Value.Val.(*bsky.GraphListitem)
+		if !ok || !sameList(item.List, l.uri, owner) {
+			return true
+		}
+		parts := strings.Split(rec.Uri, "/")
+		r[item.Subject] = append(r[item.Subject], parts[len(parts)-1])
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing listitem records: %w", err)
+	}
+	return r, nil
+}
+
+// sameList compares list URIs, allowing the expected one to use a handle
+// instead of the DID, since listitem records always use DIDs.
+func sameList(actual string, expected string, owner string) bool {
+	if actual == expected {
+		return true
+	}
+	if strings.HasPrefix(owner, "did:") {
+		return false
+	}
+	_, actualPath, _ := strings.Cut(strings.TrimPrefix(actual, "at://"), "/")
+	_, expectedPath, _ := strings.Cut(strings.TrimPrefix(expected, "at://"), "/")
+	return actualPath == expectedPath
+}
@@ -0,0 +1,229 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/atomicfile"
+	"github.com/uabluerail/bsky-tools/didset"
+	"github.com/uabluerail/bsky-tools/firehose"
+)
+
+// Activity is a QueryableDIDSet of repos that had at least one op matching
+// the predicate within the last window, e.g., accounts that posted with
+// a specific hashtag in the last 24 hours.
+//
+// Usage:
+//
+//	set := live.NewActivity(24*time.Hour, predicate)
+//	set.StateFile = "activity.json"
+//	f.Hooks = append(f.Hooks, set.Hook())
+//	go set.Run(ctx, time.Minute)
+type Activity struct {
+	// StateFile, if not empty, is used to persist the set across restarts.
+	StateFile string
+
+	window    time.Duration
+	predicate firehose.Predicate
+
+	mu             sync.Mutex
+	lastSeen       map[string]time.Time
+	waitUntilReady chan struct{}
+	readyOnce      sync.Once
+	err            error
+}
+
+func NewActivity(window time.Duration, predicate firehose.Predicate) *Activity {
+	return &Activity{
+		window:         window,
+		predicate:      predicate,
+		lastSeen:       map[string]time.Time{},
+		waitUntilReady: make(chan struct{}),
+	}
+}
+
+// Hook returns a firehose hook that records matching ops.
+func (a *Activity) Hook() firehose.Hook {
+	return firehose.Hook{
+		Predicate: a.predicate,
+		Action:    a.record,
+	}
+}
+
+func (a *Activity) record(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) {
+	// Commit time is used, so that replaying the firehose after a restart
+	// doesn't extend the window. Times in the future are not trusted.
+	now := time.Now()
+	t, err := time.Parse(time.RFC3339, commit.Time)
+	if err != nil || t.After(now) {
+		t = now
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t.After(a.lastSeen[commit.Repo]) {
+		a.lastSeen[commit.Repo] = t
+	}
+}
+
+// Run loads the state file, and then periodically removes expired entries
+// and saves the state. Blocks until ctx is done.
+func (a *Activity) Run(ctx context.Context, interval time.Duration) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "activity").
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	if err := a.load(); err != nil {
+		log.Error().Err(err).Msgf("Failed to load the state file, starting with an empty set")
+	}
+	a.readyOnce.Do(func() { close(a.waitUntilReady) })
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := a.save(); err != nil {
+				log.Error().Err(err).Msgf("Failed to save the state file")
+			}
+			a.mu.Lock()
+			a.err = fmt.Errorf("context of the background goroutine is done: %w", ctx.Err())
+			a.mu.Unlock()
+			return ctx.Err()
+		case <-t.C:
+			expired := a.expire()
+			if err := a.save(); err != nil {
+				log.Error().Err(err).Msgf("Failed to save the state file")
+			}
+			log.Trace().Msgf("Expired %d entries", expired)
+		}
+	}
+}
+
+func (a *Activity) expire() int {
+	cutoff := time.Now().Add(-a.window)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for did, t := range a.lastSeen {
+		if t.Before(cutoff) {
+			delete(a.lastSeen, did)
+			n++
+		}
+	}
+	return n
+}
+
+func (a *Activity) GetDIDs(ctx context.Context) (didset.StringSet, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-a.waitUntilReady:
+	}
+
+	cutoff := time.Now().Add(-a.window)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	r := didset.StringSet{}
+	for did, t := range a.lastSeen {
+		if !t.Before(cutoff) {
+			r[did] = true
+		}
+	}
+	return r, nil
+}
+
+func (a *Activity) Contains(ctx context.Context, did string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-a.waitUntilReady:
+	}
+
+	cutoff := time.Now().Add(-a.window)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return false, a.err
+	}
+
+	t, ok := a.lastSeen[did]
+	return ok && !t.Before(cutoff), nil
+}
+
+// LastSeen returns the time of the latest matching op from the repo,
+// if it is within the window.
+func (a *Activity) LastSeen(did string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.lastSeen[did]
+	if !ok || t.Before(time.Now().Add(-a.window)) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (a *Activity) load() error {
+	if a.StateFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(a.StateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading state file: %w", err)
+	}
+	state := map[string]time.Time{}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("parsing state file %q: %w", a.StateFile, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Ops received before the state was loaded are newer.
+	for did, t := range state {
+		if t.After(a.lastSeen[did]) {
+			a.lastSeen[did] = t
+		}
+	}
+	return nil
+}
+
+func (a *Activity) save() error {
+	if a.StateFile == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	b, err := json.Marshal(a.lastSeen)
+	a.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(a.StateFile, b, 0644); err != nil {
+		return fmt.Errorf("saving state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// Package live provides DID sets that are kept up to date by applying
+// ops from the firehose, instead of re-fetching everything periodically.
+//
+// Each set takes an initial snapshot using regular XRPC queries, and then
+// applies relevant creates and deletes from the firehose. Since some ops can
+// be missed (e.g., while the firehose is reconnecting), or their effect can't
+// be determined (e.g., deletion of a record that was created before the
+// snapshot and the snapshot doesn't have record keys), the snapshot is
+// periodically re-taken to correct any drift.
+//
+// Usage:
+//
+//	set := live.FollowsOf(client, did)
+//	f.Hooks = append(f.Hooks, set.Hook())
+//	go set.Run(ctx, time.Hour)
+//
+// Activity sets are different: they don't have a snapshot and are built
+// purely from the firehose ops observed within a time window.
+package live
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/didset"
+	"github.com/uabluerail/bsky-tools/firehose"
+	"github.com/uabluerail/bsky-tools/pagination"
+)
+
+// Set is a QueryableDIDSet that is updated from the firehose.
+type Set struct {
+	name       string
+	collection string
+	// owner, if not empty, is the only repo that can contain relevant records.
+	owner string
+	// snapshot returns members with known records (keyed by "<repo>/<collection>/<rkey>")
+	// and members for which the record is not known.
+	snapshot func(ctx context.Context) (records map[string]string, untracked didset.StringSet, err error)
+	// subject returns the DID that should be added to the set when the record is created.
+	subject func(commit *comatproto.SyncSubscribeRepos_Commit, record cbg.CBORMarshaler) (string, bool)
+
+	mu             sync.Mutex
+	records        map[string]string
+	counts         map[string]int
+	untracked      didset.StringSet
+	snapshotting   bool
+	pending        []pendingOp
+	waitUntilReady chan struct{}
+	readyOnce      sync.Once
+	err            error
+}
+
+type pendingOp struct {
+	action string
+	key    string
+	did    string
+}
+
+func newSet(name string, collection string) *Set {
+	return &Set{
+		name:           name,
+		collection:     collection,
+		records:        map[string]string{},
+		counts:         map[string]int{},
+		untracked:      didset.StringSet{},
+		waitUntilReady: make(chan struct{}),
+		// Queue up ops received before the initial snapshot.
+		snapshotting: true,
+	}
+}
+
+// Hook returns a firehose hook that applies relevant ops to the set.
+func (s *Set) Hook() firehose.Hook {
+	return firehose.Hook{
+		Predicate: firehose.IsInCollection(s.collection),
+		Action:    s.apply,
+		Deletes:   true,
+	}
+}
+
+func (s *Set) apply(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) {
+	if s.owner != "" && commit.Repo != s.owner {
+		return
+	}
+
+	p := pendingOp{action: op.Action, key: commit.Repo + "/" + op.Path}
+	switch op.Action {
+	case "create":
+		did, ok := s.subject(commit, record)
+		if !ok {
+			return
+		}
+		p.did = did
+	case "delete":
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshotting {
+		_, known := s.records[p.key]
+		if p.action == "create" || s.owner != "" || known {
+			// Snapshot might or might not include this op, so we'll re-apply it afterwards.
+			s.pending = append(s.pending, p)
+		}
+	}
+	s.applyLocked(p)
+}
+
+// applyLocked must be called with s.mu held.
+func (s *Set) applyLocked(p pendingOp) {
+	switch p.action {
+	case "create":
+		if _, exists := s.records[p.key]; !exists {
+			s.records[p.key] = p.did
+			s.counts[p.did]++
+		}
+	case "delete":
+		did, ok := s.records[p.key]
+		if !ok {
+			return
+		}
+		delete(s.records, p.key)
+		s.counts[did]--
+		if s.counts[did] <= 0 {
+			delete(s.counts, did)
+			// If the record is deleted, the DID is not in the set anymore,
+			// even if the snapshot didn't know about this record.
+			delete(s.untracked, did)
+		}
+	}
+}
+
+// Run takes the initial snapshot and then periodically re-takes it.
+// Blocks until ctx is done.
+func (s *Set) Run(ctx context.Context, reconcile time.Duration) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "live").
+		Str("name", s.name).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	t := time.NewTicker(reconcile)
+	defer t.Stop()
+	for {
+		if err := s.reconcile(ctx); err != nil {
+			log.Warn().Err(err).Msgf("Failed to take a snapshot")
+		}
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.err = fmt.Errorf("context of the background goroutine is done: %w", ctx.Err())
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Set) reconcile(ctx context.Context) error {
+	log := zerolog.Ctx(ctx)
+
+	s.mu.Lock()
+	s.snapshotting = true
+	s.mu.Unlock()
+
+	records, untracked, err := s.snapshot(ctx)
+	if err != nil {
+		// Keep queuing ops until the next attempt. Re-applying ops that are
+		// already reflected in the snapshot is a no-op.
+		return err
+	}
+	counts := map[string]int{}
+	for _, did := range records {
+		counts[did]++
+	}
+
+	s.mu.Lock()
+	old := s.membersLocked()
+	s.records = records
+	s.counts = counts
+	s.untracked = untracked
+	for _, p := range s.pending {
+		s.applyLocked(p)
+	}
+	s.snapshotting = false
+	s.pending = nil
+	drift := didset.ComputeDiff(old, s.membersLocked())
+	s.mu.Unlock()
+	s.readyOnce.Do(func() { close(s.waitUntilReady) })
+
+	log.Debug().Msgf("Snapshot taken: %d tracked records, %d untracked members, drift: +%d -%d",
+		len(records), len(untracked), len(drift.Added), len(drift.Removed))
+	return nil
+}
+
+func (s *Set) GetDIDs(ctx context.Context) (didset.StringSet, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.waitUntilReady:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.membersLocked(), nil
+}
+
+// membersLocked must be called with s.mu held.
+func (s *Set) membersLocked() didset.StringSet {
+	r := s.untracked.Clone()
+	for did := range s.counts {
+		r[did] = true
+	}
+	return r
+}
+
+func (s *Set) Contains(ctx context.Context, did string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-s.waitUntilReady:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+
+	return s.counts[did] > 0 || s.untracked[did], nil
+}
+
+// listRecords returns records of the given collection from repo, keyed by
+// "<repo>/<collection>/<rkey>". Records for which subject returns false are skipped.
+func listRecords(ctx context.Context, client *xrpc.Client, repo string, collection string, subject func(rec *comatproto.RepoListRecords_Record) (string, bool)) (map[string]string, error) {
+	r := map[string]string{}
+	err := pagination.ListRecords(ctx, client, repo, collection, func(rec *comatproto.RepoListRecords_Record) bool {
+		if did, ok := subject(rec); ok {
+			r[strings.TrimPrefix(rec.Uri, "at://")] = did
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// FollowsOf tracks accounts followed by did.
+func FollowsOf(client *xrpc.Client, did string) *Set {
+	s := newSet("follows:"+did, "app.bsky.graph.follow")
+	s.owner = did
+	s.snapshot = func(ctx context.Context) (map[string]string, didset.StringSet, error) {
+		records, err := listRecords(ctx, client, did, "app.bsky.graph.follow", func(rec *comatproto.RepoListRecords_Record) (string, bool) {
+			item, ok := rec.Value.Val.(*bsky.GraphFollow)
+			if !ok {
+				return "", false
+			}
+			return item.Subject, true
+		})
+		return records, didset.StringSet{}, err
+	}
+	s.subject = func(commit *comatproto.SyncSubscribeRepos_Commit, record cbg.CBORMarshaler) (string, bool) {
+		item, ok := record.(*bsky.GraphFollow)
+		if !ok {
+			return "", false
+		}
+		return item.Subject, true
+	}
+	return s
+}
+
+// FollowersOf tracks followers of did. Since the initial snapshot doesn't
+// contain record keys, unfollows by accounts that followed before the
+// snapshot was taken are applied only during reconciliation.
+func FollowersOf(client *xrpc.Client, did string) *Set {
+	s := newSet("followers:"+did, "app.bsky.graph.follow")
+	source := didset.FollowersOf(client, did)
+	s.snapshot = func(ctx context.Context) (map[string]string, didset.StringSet, error) {
+		dids, err := source.GetDIDs(ctx)
+		return map[string]string{}, dids, err
+	}
+	s.subject = func(commit *comatproto.SyncSubscribeRepos_Commit, record cbg.CBORMarshaler) (string, bool) {
+		item, ok := record.(*bsky.GraphFollow)
+		if !ok || item.Subject != did {
+			return "", false
+		}
+		return commit.Repo, true
+	}
+	return s
+}
+
+// BlockedBy tracks accounts blocked by did.
+func BlockedBy(client *xrpc.Client, did string) *Set {
+	s := newSet("blocks:"+did, "app.bsky.graph.block")
+	s.owner = did
+	s.snapshot = func(ctx context.Context) (map[string]string, didset.StringSet, error) {
+		records, err := listRecords(ctx, client, did, "app.bsky.graph.block", func(rec *comatproto.RepoListRecords_Record) (string, bool) {
+			item, ok := rec.Value.Val.(*bsky.GraphBlock)
+			if !ok {
+				return "", false
+			}
+			return item.Subject, true
+		})
+		return records, didset.StringSet{}, err
+	}
+	s.subject = func(commit *comatproto.SyncSubscribeRepos_Commit, record cbg.CBORMarshaler) (string, bool) {
+		item, ok := record.(*bsky.GraphBlock)
+		if !ok {
+			return "", false
+		}
+		return item.Subject, true
+	}
+	return s
+}
+
+// ListMembers tracks members of the list with the given at:// URI.
+func ListMembers(client *xrpc.Client, listURI string) (*Set, error) {
+	owner, _, _ := strings.Cut(strings.TrimPrefix(listURI, "at://"), "/")
+	if !strings.HasPrefix(listURI, "at://") || !strings.HasPrefix(owner, "did:") {
+		return nil, fmt.Errorf("list URI must be in the form of at://did:.../app.bsky.graph.list/..., got %q", listURI)
+	}
+
+	s := newSet("list:"+listURI, "app.bsky.graph.listitem")
+	s.owner = owner
+	source := didset.List(client, listURI, didset.ListFromRecords)
+	s.snapshot = func(ctx context.Context) (map[string]string, didset.StringSet, error) {
+		items, err := source.GetItems(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		records := map[string]string{}
+		for did, rkeys := range items {
+			for _, rkey := range rkeys {
+				records[owner+"/app.bsky.graph.listitem/"+rkey] = did
+			}
+		}
+		return records, didset.StringSet{}, nil
+	}
+	s.subject = func(commit *comatproto.SyncSubscribeRepos_Commit, record cbg.CBORMarshaler) (string, bool) {
+		item, ok := record.(*bsky.GraphListitem)
+		if !ok || item.List != listURI {
+			return "", false
+		}
+		return item.Subject, true
+	}
+	return s, nil
+}
@@ -34,8 +34,23 @@ func (u *union) GetDIDs(ctx context.Context) (StringSet, error) {
 	return r, nil
 }
 
+func (u *union) Contains(ctx context.Context, did string) (bool, error) {
+	for i, s := range u.sets {
+		r, err := contains(ctx, s, did)
+		if err != nil {
+			return false, fmt.Errorf("evaluating %d'th set of union: %w", i, err)
+		}
+		if r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Union returns DIDs that are members of any of the sets.
+// The result implements QueryableDIDSet only if all of the sets do.
 func Union(sets ...DIDSet) DIDSet {
-	return &union{sets: sets}
+	return queryableIf(&union{sets: sets}, sets...)
 }
 
 type difference struct {
@@ -67,8 +82,25 @@ func (d *difference) GetDIDs(ctx context.Context) (StringSet, error) {
 	return left, nil
 }
 
+func (d *difference) Contains(ctx context.Context, did string) (bool, error) {
+	r, err := contains(ctx, d.left, did)
+	if err != nil {
+		return false, fmt.Errorf("evaluating left side of a difference: %w", err)
+	}
+	if !r {
+		return false, nil
+	}
+	r, err = contains(ctx, d.right, did)
+	if err != nil {
+		return false, fmt.Errorf("evaluating right side of a difference: %w", err)
+	}
+	return !r, nil
+}
+
+// Difference returns DIDs that are members of left but not of right.
+// The result implements QueryableDIDSet only if both sets do.
 func Difference(left DIDSet, right DIDSet) DIDSet {
-	return &difference{left: left, right: right}
+	return queryableIf(&difference{left: left, right: right}, left, right)
 }
 
 type intersection struct {
@@ -109,6 +141,69 @@ func (i *intersection) GetDIDs(ctx context.Context) (StringSet, error) {
 	return r, nil
 }
 
+func (i *intersection) Contains(ctx context.Context, did string) (bool, error) {
+	if len(i.sets) == 0 {
+		return false, nil
+	}
+	for n, s := range i.sets {
+		r, err := contains(ctx, s, did)
+		if err != nil {
+			return false, fmt.Errorf("evaluating %d'th set of intersection: %w", n, err)
+		}
+		if !r {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Intersection returns DIDs that are members of all of the sets.
+// The result implements QueryableDIDSet only if all of the sets do.
 func Intersection(sets ...DIDSet) DIDSet {
-	return &intersection{sets: sets}
+	return queryableIf(&intersection{sets: sets}, sets...)
+}
+
+// queryableIf returns the set as is if all of its operands implement
+// QueryableDIDSet. Otherwise it hides the Contains method of the set,
+// because answering a query would require fetching non-queryable operands
+// in full every time. Such sets need to be wrapped with Cached to be queried.
+func queryableIf(set QueryableDIDSet, operands ...DIDSet) DIDSet {
+	for _, s := range operands {
+		if _, ok := s.(QueryableDIDSet); !ok {
+			return opaque{set: set}
+		}
+	}
+	return set
+}
+
+// opaque exposes only the methods of the wrapped set that don't query
+// individual DIDs.
+type opaque struct {
+	set DIDSet
+}
+
+func (o opaque) GetDIDs(ctx context.Context) (StringSet, error) {
+	return o.set.GetDIDs(ctx)
+}
+
+func (o opaque) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	return getAnnotated(ctx, o.set)
+}
+
+func (o opaque) Iterate(ctx context.Context, fn func(did string) bool) error {
+	return Iterate(ctx, o.set, fn)
+}
+
+// contains checks if the DID is in the set, falling back to fetching
+// the whole set if it doesn't implement QueryableDIDSet. Set operations
+// are only queryable when all of their operands are, so they never fall back.
+func contains(ctx context.Context, set DIDSet, did string) (bool, error) {
+	if q, ok := set.(QueryableDIDSet); ok {
+		return q.Contains(ctx, did)
+	}
+	entries, err := set.GetDIDs(ctx)
+	if err != nil {
+		return false, err
+	}
+	return entries[did], nil
 }
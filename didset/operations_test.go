@@ -0,0 +1,63 @@
+package didset
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOperationsQueryable(t *testing.T) {
+	a := Annotate("a", Const("did:plc:a", "did:plc:b"))
+	b := Annotate("b", Const("did:plc:b", "did:plc:c"))
+	hidden := notQueryable{b}
+
+	tests := []struct {
+		name      string
+		set       DIDSet
+		queryable bool
+		want      []string
+	}{
+		{name: "union", set: Union(a, b), queryable: true,
+			want: []string{"did:plc:a", "did:plc:b", "did:plc:c"}},
+		{name: "union with non-queryable", set: Union(a, hidden),
+			want: []string{"did:plc:a", "did:plc:b", "did:plc:c"}},
+		{name: "intersection", set: Intersection(a, b), queryable: true,
+			want: []string{"did:plc:b"}},
+		{name: "intersection with non-queryable", set: Intersection(hidden, a),
+			want: []string{"did:plc:b"}},
+		{name: "difference", set: Difference(a, b), queryable: true,
+			want: []string{"did:plc:a"}},
+		{name: "difference with non-queryable", set: Difference(a, hidden),
+			want: []string{"did:plc:a"}},
+		{name: "nested non-queryable", set: Union(a, Difference(a, hidden)),
+			want: []string{"did:plc:a", "did:plc:b"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, ok := tc.set.(QueryableDIDSet)
+			if ok != tc.queryable {
+				t.Errorf("implements QueryableDIDSet: got %v, want %v", ok, tc.queryable)
+			}
+
+			got, err := tc.set.GetDIDs(ctx)
+			if err != nil {
+				t.Fatalf("GetDIDs: %s", err)
+			}
+			if diff := compareSets(got, tc.want); diff != "" {
+				t.Errorf("GetDIDs: %s", diff)
+			}
+
+			annotated, err := getAnnotated(ctx, tc.set)
+			if err != nil {
+				t.Fatalf("getAnnotated: %s", err)
+			}
+			if len(annotated) != len(tc.want) {
+				t.Errorf("getAnnotated returned %d DIDs, want %d", len(annotated), len(tc.want))
+			}
+			if sources := annotated["did:plc:a"]; got["did:plc:a"] && len(sources) == 0 {
+				t.Errorf("annotations are lost for did:plc:a")
+			}
+		})
+	}
+}
@@ -12,47 +12,55 @@ import (
 	"github.com/bluesky-social/indigo/xrpc"
 )
 
+// recordSubjects passes subjects of all records in the collection to fn,
+// until it returns false.
+func recordSubjects(ctx context.Context, client *xrpc.Client, repo string, collection string, subject func(rec *comatproto.RepoListRecords_Record) (string, bool), fn func(did string) bool) error {
+	return pagination.ListRecords(ctx, client, repo, collection, func(rec *comatproto.RepoListRecords_Record) bool {
+		did, ok := subject(rec)
+		return !ok || fn(did)
+	})
+}
+
+// iterateBlocks passes subjects of all app.bsky.graph.block records in the repo to fn.
+func iterateBlocks(ctx context.Context, client *xrpc.Client, did string, fn func(did string) bool) error {
+	err := recordSubjects(ctx, client, did, "app.bsky.graph.block", func(rec *comatproto.RepoListRecords_Record) (string, bool) {
+		item, ok := rec.Value.Val.(*bsky.GraphBlock)
+		if !ok {
+			return "", false
+		}
+		return item.Subject, true
+	}, fn)
+	if err != nil {
+		return fmt.Errorf("listing blocked users: %w", err)
+	}
+	return nil
+}
+
 type blocked struct {
 	client *xrpc.Client
 }
 
 func (b *blocked) GetDIDs(ctx context.Context) (StringSet, error) {
+	r, err := collect(ctx, b.Iterate)
+	if err != nil {
+		return nil, err
+	}
+	zerolog.Ctx(ctx).Trace().Str("didset", "blocked").Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+func (b *blocked) Iterate(ctx context.Context, fn func(did string) bool) error {
 	log := zerolog.Ctx(ctx).With().
 		Str("module", "didset").
 		Str("didset", "blocked").
 		Logger()
 	ctx = log.WithContext(ctx)
 
-	r := StringSet{}
-
 	resp, err := comatproto.ServerGetSession(ctx, b.client)
 	if err != nil {
-		return nil, fmt.Errorf("ServerGetSession: %w", err)
-	}
-	self := resp.Did
-
-	cursor := ""
-	for {
-		resp, err := comatproto.RepoListRecords(ctx, b.client, "app.bsky.graph.block", cursor, 100, self, false, "", "")
-		if err != nil {
-			return nil, fmt.Errorf("listing blocked users: %w", err)
-		}
-		if resp.Cursor == nil || *resp.Cursor == "" {
-			break
-		}
-		cursor = *resp.Cursor
-		for _, rec := range resp.Records {
-			item, ok := rec.Value.Val.(*bsky.GraphBlock)
-			if !ok {
-				continue
-			}
-
-			r[item.Subject] = true
-		}
+		return fmt.Errorf("ServerGetSession: %w", err)
 	}
-
-	log.Trace().Msgf("Got %d dids", len(r))
-	return r, nil
+	return iterateBlocks(ctx, b.client, resp.Did, fn)
 }
 
 func BlockedUsers(authclient *xrpc.Client) DIDSet {
@@ -65,83 +73,31 @@ type blockedBy struct {
 }
 
 func (b *blockedBy) GetDIDs(ctx context.Context) (StringSet, error) {
-	log := zerolog.Ctx(ctx).With().
-		Str("module", "didset").
-		Str("didset", "blocked").
-		Logger()
-	ctx = log.WithContext(ctx)
-
-	r := StringSet{}
-
-	cursor := ""
-	for {
-		resp, err := comatproto.RepoListRecords(ctx, b.client, "app.bsky.graph.block", cursor, 100, b.did, false, "", "")
-		if err != nil {
-			return nil, fmt.Errorf("listing blocked users: %w", err)
-		}
-		if resp.Cursor == nil || *resp.Cursor == "" {
-			break
-		}
-		cursor = *resp.Cursor
-		for _, rec := range resp.Records {
-			item, ok := rec.Value.Val.(*bsky.GraphBlock)
-			if !ok {
-				continue
-			}
-
-			r[item.Subject] = true
-		}
+	r, err := collect(ctx, b.Iterate)
+	if err != nil {
+		return nil, err
 	}
-
-	log.Trace().Msgf("Got %d dids", len(r))
+	zerolog.Ctx(ctx).Trace().Str("didset", "blocked_by").Str("blocked_by", b.did).Msgf("Got %d dids", len(r))
 	return r, nil
 }
 
-func BlockedBy(authclient *xrpc.Client, did string) DIDSet {
-	return &blockedBy{client: authclient, did: did}
-}
-
-type muteList struct {
-	client *xrpc.Client
-	url    string
-}
-
-func (l *muteList) GetDIDs(ctx context.Context) (StringSet, error) {
+func (b *blockedBy) Iterate(ctx context.Context, fn func(did string) bool) error {
 	log := zerolog.Ctx(ctx).With().
 		Str("module", "didset").
-		Str("didset", "mutelist").
-		Str("list_url", l.url).
+		Str("didset", "blocked_by").
+		Str("blocked_by", b.did).
 		Logger()
 	ctx = log.WithContext(ctx)
 
-	r := StringSet{}
-	cursor := ""
-	for {
-		resp, err := bsky.GraphGetList(ctx, l.client, cursor, 100, l.url)
-		if err != nil {
-			return nil, fmt.Errorf("app.bsky.graph.getList: %w", err)
-		}
-
-		if len(resp.Items) == 0 {
-			break
-		}
-
-		for _, item := range resp.Items {
-			r[item.Subject.Did] = true
-		}
-
-		if resp.Cursor == nil {
-			break
-		}
-		cursor = *resp.Cursor
-	}
-	log.Trace().Msgf("Got %d dids", len(r))
+	return iterateBlocks(ctx, b.client, b.did, fn)
+}
 
-	return r, nil
+func BlockedBy(authclient *xrpc.Client, did string) DIDSet {
+	return &blockedBy{client: authclient, did: did}
 }
 
 func MuteList(authclient *xrpc.Client, url string) DIDSet {
-	return &muteList{client: authclient, url: url}
+	return List(authclient, url, ListFromAppView)
 }
 
 type followers struct {
@@ -150,6 +106,15 @@ type followers struct {
 }
 
 func (f *followers) GetDIDs(ctx context.Context) (StringSet, error) {
+	r, err := collect(ctx, f.Iterate)
+	if err != nil {
+		return nil, err
+	}
+	zerolog.Ctx(ctx).Trace().Str("didset", "followers").Str("followers_of", f.did).Msgf("Got %d dids", len(r))
+	return r, nil
+}
+
+func (f *followers) Iterate(ctx context.Context, fn func(did string) bool) error {
 	log := zerolog.Ctx(ctx).With().
 		Str("module", "didset").
 		Str("didset", "followers").
@@ -157,30 +122,30 @@ func (f *followers) GetDIDs(ctx context.Context) (StringSet, error) {
 		Logger()
 	ctx = log.WithContext(ctx)
 
-	r := StringSet{}
-	cursor := ""
-	for {
-		resp, err := bsky.GraphGetFollowers(ctx, f.client, f.did, cursor, 100)
-		if err != nil {
-			return nil, fmt.Errorf("app.bsky.graph.getFollowers: %w", err)
-		}
-
-		if len(resp.Followers) == 0 {
-			break
-		}
-
-		for _, item := range resp.Followers {
-			r[item.Did] = true
-		}
-
-		if resp.Cursor == nil {
-			break
-		}
-		cursor = *resp.Cursor
+	err := pagination.ForEach(
+		func(cursor string) (resp *bsky.GraphGetFollowers_Output, nextCursor string, err error) {
+			resp, err = bsky.GraphGetFollowers(ctx, f.client, f.did, cursor, 100)
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *bsky.GraphGetFollowers_Output) (bool, error) {
+			for _, item := range resp.Followers {
+				if !fn(item.Did) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("app.bsky.graph.getFollowers: %w", err)
 	}
-	log.Trace().Msgf("Got %d dids", len(r))
-
-	return r, nil
+	return nil
 }
 
 func FollowersOf(authclient *xrpc.Client, did string) DIDSet {
@@ -193,6 +158,10 @@ type follows struct {
 }
 
 func (f *follows) GetDIDs(ctx context.Context) (StringSet, error) {
+	return collect(ctx, f.Iterate)
+}
+
+func (f *follows) Iterate(ctx context.Context, fn func(did string) bool) error {
 	log := zerolog.Ctx(ctx).With().
 		Str("module", "didset").
 		Str("didset", "follows").
@@ -200,7 +169,7 @@ func (f *follows) GetDIDs(ctx context.Context) (StringSet, error) {
 		Logger()
 	ctx = log.WithContext(ctx)
 
-	return pagination.Reduce(
+	return pagination.ForEach(
 		func(cursor string) (resp *bsky.GraphGetFollows_Output, nextCursor string, err error) {
 			resp, err = bsky.GraphGetFollows(ctx, f.client, f.did, cursor, 100)
 			if err != nil {
@@ -211,14 +180,13 @@ func (f *follows) GetDIDs(ctx context.Context) (StringSet, error) {
 			}
 			return
 		},
-		func(resp *bsky.GraphGetFollows_Output, acc StringSet) (StringSet, error) {
-			if acc == nil {
-				acc = make(StringSet)
-			}
+		func(resp *bsky.GraphGetFollows_Output) (bool, error) {
 			for _, i := range resp.Follows {
-				acc[i.Did] = true
+				if !fn(i.Did) {
+					return false, nil
+				}
 			}
-			return acc, nil
+			return true, nil
 		},
 	)
 }
@@ -236,6 +204,10 @@ type followRecords struct {
 }
 
 func (f *followRecords) GetDIDs(ctx context.Context) (StringSet, error) {
+	return collect(ctx, f.Iterate)
+}
+
+func (f *followRecords) Iterate(ctx context.Context, fn func(did string) bool) error {
 	log := zerolog.Ctx(ctx).With().
 		Str("module", "didset").
 		Str("didset", "follows").
@@ -243,32 +215,13 @@ func (f *followRecords) GetDIDs(ctx context.Context) (StringSet, error) {
 		Logger()
 	ctx = log.WithContext(ctx)
 
-	return pagination.Reduce(
-		func(cursor string) (resp *comatproto.RepoListRecords_Output, nextCursor string, err error) {
-			resp, err = comatproto.RepoListRecords(ctx, f.client, "app.bsky.graph.follow", cursor, 100, f.did, false, "", "")
-			if err != nil {
-				return
-			}
-			if resp.Cursor != nil {
-				nextCursor = *resp.Cursor
-			}
-			return
-		},
-		func(resp *comatproto.RepoListRecords_Output, acc StringSet) (StringSet, error) {
-			if acc == nil {
-				acc = make(StringSet)
-			}
-			for _, rec := range resp.Records {
-				item, ok := rec.Value.Val.(*bsky.GraphFollow)
-				if !ok {
-					continue
-				}
-
-				acc[item.Subject] = true
-			}
-			return acc, nil
-		},
-	)
+	return recordSubjects(ctx, f.client, f.did, "app.bsky.graph.follow", func(rec *comatproto.RepoListRecords_Record) (string, bool) {
+		item, ok := rec.Value.Val.(*bsky.GraphFollow)
+		if !ok {
+			return "", false
+		}
+		return item.Subject, true
+	}, fn)
 }
 
 func FollowRecordsOf(authclient *xrpc.Client, did string) DIDSet {
@@ -0,0 +1,217 @@
+package didset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+const (
+	testOwner = "did:plc:owner"
+	testList  = "at://did:plc:owner/app.bsky.graph.list/abc"
+)
+
+// fakePDS serves the same pages of DIDs for every paginated method,
+// wrapped into the response shape of that method.
+type fakePDS struct {
+	pages    [][]string
+	requests int
+}
+
+func (f *fakePDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[len("/xrpc/"):]
+	if method == "com.atproto.server.getSession" {
+		writeJSON(w, map[string]any{"did": testOwner, "handle": "owner.test"})
+		return
+	}
+
+	f.requests++
+	page := 0
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		var err error
+		page, err = strconv.Atoi(c)
+		if err != nil || page >= len(f.pages) {
+			http.Error(w, fmt.Sprintf("bad cursor %q", c), http.StatusBadRequest)
+			return
+		}
+	}
+	var dids []string
+	if page < len(f.pages) {
+		dids = f.pages[page]
+	}
+
+	resp := map[string]any{}
+	if page+1 < len(f.pages) {
+		resp["cursor"] = strconv.Itoa(page + 1)
+	}
+
+	switch method {
+	case "app.bsky.graph.getFollowers", "app.bsky.graph.getFollows":
+		profiles := []any{}
+		for _, did := range dids {
+			profiles = append(profiles, map[string]any{"did": did, "handle": "x.test"})
+		}
+		resp["subject"] = map[string]any{"did": testOwner, "handle": "owner.test"}
+		if method == "app.bsky.graph.getFollowers" {
+			resp["followers"] = profiles
+		} else {
+			resp["follows"] = profiles
+		}
+	case "app.bsky.graph.getList":
+		items := []any{}
+		for _, did := range dids {
+			items = append(items, map[string]any{"subject": map[string]any{"did": did, "handle": "x.test"}})
+		}
+		resp["list"] = map[string]any{"uri": testList, "name": "test"}
+		resp["items"] = items
+	case "com.atproto.repo.listRecords":
+		collection := r.URL.Query().Get("collection")
+		records := []any{}
+		for i, did := range dids {
+			value := map[string]any{"$type": collection, "subject": did, "createdAt": "2024-01-01T00:00:00Z"}
+			if collection == "app.bsky.graph.listitem" {
+				value["list"] = testList
+			}
+			records = append(records, map[string]any{
+				"uri":   fmt.Sprintf("at://%s/%s/%d-%d", testOwner, collection, page, i),
+				"cid":   "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm",
+				"value": value,
+			})
+		}
+		resp["records"] = records
+	default:
+		http.Error(w, "unknown method "+method, http.StatusNotImplemented)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestPaginatedSources(t *testing.T) {
+	sources := []struct {
+		name string
+		new  func(client *xrpc.Client) DIDSet
+	}{
+		{"FollowersOf", func(c *xrpc.Client) DIDSet { return FollowersOf(c, testOwner) }},
+		{"FollowsOf", func(c *xrpc.Client) DIDSet { return FollowsOf(c, testOwner) }},
+		{"FollowRecordsOf", func(c *xrpc.Client) DIDSet { return FollowRecordsOf(c, testOwner) }},
+		{"BlockedUsers", func(c *xrpc.Client) DIDSet { return BlockedUsers(c) }},
+		{"BlockedBy", func(c *xrpc.Client) DIDSet { return BlockedBy(c, testOwner) }},
+		{"MuteList", func(c *xrpc.Client) DIDSet { return MuteList(c, testList) }},
+		{"ListFromRecords", func(c *xrpc.Client) DIDSet { return List(c, testList, ListFromRecords) }},
+	}
+
+	tests := []struct {
+		name  string
+		pages [][]string
+		want  []string
+	}{
+		{
+			name:  "empty",
+			pages: nil,
+			want:  []string{},
+		},
+		{
+			name:  "empty page",
+			pages: [][]string{{}},
+			want:  []string{},
+		},
+		{
+			name:  "single page",
+			pages: [][]string{{"did:plc:a", "did:plc:b"}},
+			want:  []string{"did:plc:a", "did:plc:b"},
+		},
+		{
+			name:  "multiple pages",
+			pages: [][]string{{"did:plc:a"}, {"did:plc:b", "did:plc:c"}, {"did:plc:d"}},
+			want:  []string{"did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d"},
+		},
+		{
+			name:  "empty page in the middle",
+			pages: [][]string{{"did:plc:a"}, {}, {"did:plc:b"}},
+			want:  []string{"did:plc:a", "did:plc:b"},
+		},
+	}
+
+	for _, src := range sources {
+		for _, tc := range tests {
+			t.Run(src.name+"/"+tc.name, func(t *testing.T) {
+				pds := &fakePDS{pages: tc.pages}
+				srv := httptest.NewServer(pds)
+				defer srv.Close()
+
+				got, err := src.new(&xrpc.Client{Host: srv.URL}).GetDIDs(context.Background())
+				if err != nil {
+					t.Fatalf("GetDIDs: %s", err)
+				}
+				if got == nil {
+					t.Fatalf("GetDIDs returned nil set")
+				}
+				if diff := compareSets(got, tc.want); diff != "" {
+					t.Errorf("unexpected result: %s", diff)
+				}
+				wantRequests := len(tc.pages)
+				if wantRequests == 0 {
+					wantRequests = 1
+				}
+				if pds.requests != wantRequests {
+					t.Errorf("got %d requests, want %d", pds.requests, wantRequests)
+				}
+			})
+		}
+	}
+}
+
+func compareSets(got StringSet, want []string) string {
+	missing := []string{}
+	for _, did := range want {
+		if !got[did] {
+			missing = append(missing, did)
+		}
+	}
+	extra := []string{}
+	wantSet := Const(want...).(StringSet)
+	for did := range got {
+		if !wantSet[did] {
+			extra = append(extra, did)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return ""
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return fmt.Sprintf("missing %v, extra %v", missing, extra)
+}
+
+func TestIterateStopsEarly(t *testing.T) {
+	pds := &fakePDS{pages: [][]string{{"did:plc:a", "did:plc:b"}, {"did:plc:c"}, {"did:plc:d"}}}
+	srv := httptest.NewServer(pds)
+	defer srv.Close()
+
+	got := []string{}
+	err := Iterate(context.Background(), FollowersOf(&xrpc.Client{Host: srv.URL}, testOwner), func(did string) bool {
+		got = append(got, did)
+		return len(got) < 3
+	})
+	if err != nil {
+		t.Fatalf("Iterate: %s", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("got %v, want 3 DIDs", got)
+	}
+	if pds.requests != 2 {
+		t.Errorf("got %d requests, want 2", pds.requests)
+	}
+}
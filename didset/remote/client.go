@@ -0,0 +1,164 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/uabluerail/bsky-tools/didset"
+)
+
+type source struct {
+	client  *http.Client
+	baseURL string
+	name    string
+
+	mu      sync.Mutex
+	version string
+	members didset.StringSet
+}
+
+// Source returns a set that fetches the named set from the server at baseURL.
+// It keeps the last fetched copy and only requests changes since then,
+// falling back to fetching the whole set if the server doesn't have them.
+// Every GetDIDs makes a request, so it is meant to be wrapped in didset.Cached,
+// as New does.
+func Source(client *http.Client, baseURL string, name string) didset.DIDSet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &source{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		name:    name,
+	}
+}
+
+// New returns a set that mirrors the named set from the server at baseURL,
+// checking for changes every refresh interval.
+func New(ctx context.Context, baseURL string, name string, refresh time.Duration, opts ...didset.CacheOption) didset.CachedDIDSet {
+	return didset.Cached(ctx, refresh, Source(nil, baseURL, name), opts...)
+}
+
+// errGone is returned when the server doesn't have the diff since our version.
+var errGone = fmt.Errorf("version is not available anymore")
+
+func (s *source) GetDIDs(ctx context.Context) (didset.StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "remote").
+		Str("set", s.name).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.members != nil {
+		err := s.applyDiff(ctx)
+		switch {
+		case err == nil:
+			return s.members.Clone(), nil
+		case err == errGone:
+			log.Debug().Msgf("Diff since version %q is not available, fetching the whole set", s.version)
+		default:
+			return nil, err
+		}
+	}
+
+	if err := s.fetchAll(ctx); err != nil {
+		return nil, err
+	}
+	return s.members.Clone(), nil
+}
+
+func (s *source) applyDiff(ctx context.Context) error {
+	resp, err := s.get(ctx, "/diff?since="+url.QueryEscape(s.version), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return errGone
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	var diff diffResponse
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		return fmt.Errorf("parsing diff: %w", err)
+	}
+
+	for _, did := range diff.Removed {
+		delete(s.members, did)
+	}
+	for _, did := range diff.Added {
+		s.members[did] = true
+	}
+	s.version = diff.Version
+	return nil
+}
+
+func (s *source) fetchAll(ctx context.Context) error {
+	header := http.Header{}
+	if s.members != nil {
+		header.Set("If-None-Match", strconv.Quote(s.version))
+	}
+	resp, err := s.get(ctx, "", header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	var export exportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&export); err != nil {
+		return fmt.Errorf("parsing set: %w", err)
+	}
+
+	members := make(didset.StringSet, len(export.DIDs))
+	for _, did := range export.DIDs {
+		members[did] = true
+	}
+	s.members = members
+	s.version = export.Version
+	return nil
+}
+
+func (s *source) get(ctx context.Context, suffix string, header http.Header) (*http.Response, error) {
+	u := s.baseURL + "/sets/" + url.PathEscape(s.name) + suffix
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", u, err)
+	}
+	return resp, nil
+}
+
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("GET %s: %s: %s", resp.Request.URL, resp.Status, strings.TrimSpace(string(b)))
+}
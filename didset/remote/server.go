@@ -0,0 +1,370 @@
+// Package remote serves named DID sets over HTTP and provides a client
+// that keeps a local copy of a remote set.
+//
+// Endpoints:
+//
+//   - GET /sets: names of all sets with their current versions and sizes.
+//   - GET /sets/<name>: all members and the current version. The version is
+//     also returned in the ETag header, and If-None-Match is supported.
+//   - GET /sets/<name>/contains?did=<did>: membership check.
+//   - GET /sets/<name>/diff?since=<version>: changes since the given version.
+//     Returns 410 Gone if the version is too old or unknown, in which case
+//     the client should fetch the whole set again.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/uabluerail/bsky-tools/didset"
+	"github.com/uabluerail/bsky-tools/httpserver"
+)
+
+type Server struct {
+	// Refresh is how often sets are re-evaluated to detect changes.
+	Refresh time.Duration
+	// HistorySize is the number of recent diffs kept for each set.
+	HistorySize int
+
+	// epoch makes versions from different server runs distinct.
+	epoch string
+	sets  map[string]*servedSet
+	names []string
+}
+
+type servedSet struct {
+	source didset.DIDSet
+
+	mu      sync.Mutex
+	ready   bool
+	err     error
+	version int
+	members *didset.CompactSet
+	// history[i] turns version history[i].from into history[i].from+1.
+	history []versionDiff
+}
+
+type versionDiff struct {
+	from int
+	diff didset.Diff
+}
+
+type setInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Size    int    `json:"size"`
+	Error   string `json:"error,omitempty"`
+}
+
+type exportResponse struct {
+	Version string   `json:"version"`
+	DIDs    []string `json:"dids"`
+}
+
+type containsResponse struct {
+	Version string `json:"version"`
+	DID     string `json:"did"`
+	Member  bool   `json:"member"`
+}
+
+type diffResponse struct {
+	Version string   `json:"version"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+func NewServer(sets map[string]didset.DIDSet) *Server {
+	s := &Server{
+		Refresh:     time.Minute,
+		HistorySize: 100,
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		sets:        map[string]*servedSet{},
+	}
+	for name, set := range sets {
+		s.sets[name] = &servedSet{source: set}
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+// Run serves HTTP requests on addr and periodically refreshes the sets.
+// Blocks until ctx is done or the server fails.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	log := zerolog.Ctx(ctx).With().Str("module", "remote").Logger()
+	ctx = log.WithContext(ctx)
+
+	return httpserver.Run(ctx, &http.Server{Addr: addr, Handler: s}, s.refreshLoop)
+}
+
+func (s *Server) refreshLoop(ctx context.Context) error {
+	t := time.NewTicker(s.Refresh)
+	defer t.Stop()
+	for {
+		s.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// refresh re-evaluates all sets concurrently.
+func (s *Server) refresh(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range s.names {
+		wg.Add(1)
+		go func(name string, set *servedSet) {
+			defer wg.Done()
+			if err := set.refresh(ctx, s.HistorySize); err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Str("set", name).Msgf("Failed to refresh the set")
+			}
+		}(name, s.sets[name])
+	}
+	wg.Wait()
+}
+
+func (set *servedSet) refresh(ctx context.Context, historySize int) error {
+	members, err := didset.GetCompact(ctx, set.source)
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if err != nil {
+		set.err = err
+		return err
+	}
+	set.err = nil
+
+	if !set.ready {
+		set.ready = true
+		set.members = members
+		return nil
+	}
+	if members == set.members {
+		return nil
+	}
+	diff := set.members.Diff(members)
+	set.members = members
+	if diff.Empty() {
+		return nil
+	}
+	set.history = append(set.history, versionDiff{from: set.version, diff: diff})
+	if len(set.history) > historySize {
+		set.history = set.history[len(set.history)-historySize:]
+	}
+	set.version++
+	return nil
+}
+
+func (s *Server) versionString(v int) string {
+	return fmt.Sprintf("%s-%d", s.epoch, v)
+}
+
+func (s *Server) parseVersion(v string) (int, bool) {
+	epoch, n, ok := strings.Cut(v, "-")
+	if !ok || epoch != s.epoch {
+		return 0, false
+	}
+	r, err := strconv.Atoi(n)
+	if err != nil {
+		return 0, false
+	}
+	return r, true
+}
+
+// snapshot returns the current state of the set, or an HTTP status code
+// and a message if it is not available.
+func (set *servedSet) snapshot() (*didset.CompactSet, int, int, string) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if !set.ready {
+		if set.err != nil {
+			return nil, 0, http.StatusServiceUnavailable, set.err.Error()
+		}
+		return nil, 0, http.StatusServiceUnavailable, "set is not loaded yet"
+	}
+	return set.members, set.version, 0, ""
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.Trim(req.URL.Path, "/")
+	if path == "sets" {
+		s.serveIndex(w, req)
+		return
+	}
+	rest, ok := strings.CutPrefix(path, "sets/")
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	name, action, _ := strings.Cut(rest, "/")
+	set, ok := s.sets[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown set %q", name), http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "":
+		s.serveExport(w, req, set)
+	case "contains":
+		s.serveContains(w, req, set)
+	case "diff":
+		s.serveDiff(w, req, set)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, req *http.Request) {
+	r := []setInfo{}
+	for _, name := range s.names {
+		set := s.sets[name]
+		set.mu.Lock()
+		info := setInfo{Name: name}
+		if set.ready {
+			info.Version = s.versionString(set.version)
+			info.Size = set.members.Len()
+		}
+		if set.err != nil {
+			info.Error = set.err.Error()
+		}
+		set.mu.Unlock()
+		r = append(r, info)
+	}
+	writeJSON(w, r)
+}
+
+func (s *Server) serveExport(w http.ResponseWriter, req *http.Request, set *servedSet) {
+	members, version, status, msg := set.snapshot()
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	etag := strconv.Quote(s.versionString(version))
+	w.Header().Set("ETag", etag)
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, m := range strings.Split(match, ",") {
+			if m = strings.TrimSpace(m); m == etag || m == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	// Members are written one by one to avoid building the whole response in memory.
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method == http.MethodHead {
+		return
+	}
+	fmt.Fprintf(w, `{"version":%s,"dids":[`, etag)
+	first := true
+	members.ForEach(func(did string) bool {
+		b, _ := json.Marshal(did)
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+		_, err := w.Write(b)
+		return err == nil
+	})
+	w.Write([]byte("]}\n"))
+}
+
+func (s *Server) serveContains(w http.ResponseWriter, req *http.Request, set *servedSet) {
+	did := req.URL.Query().Get("did")
+	if did == "" {
+		http.Error(w, "did parameter is required", http.StatusBadRequest)
+		return
+	}
+	members, version, status, msg := set.snapshot()
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	writeJSON(w, containsResponse{
+		Version: s.versionString(version),
+		DID:     did,
+		Member:  members.Has(did),
+	})
+}
+
+func (s *Server) serveDiff(w http.ResponseWriter, req *http.Request, set *servedSet) {
+	since, ok := s.parseVersion(req.URL.Query().Get("since"))
+	if !ok {
+		http.Error(w, "unknown version", http.StatusGone)
+		return
+	}
+
+	set.mu.Lock()
+	if !set.ready {
+		set.mu.Unlock()
+		http.Error(w, "set is not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	version := set.version
+	if since > version || len(set.history) > 0 && since < set.history[0].from || len(set.history) == 0 && since != version {
+		set.mu.Unlock()
+		http.Error(w, "version is too old", http.StatusGone)
+		return
+	}
+	added, removed := didset.StringSet{}, didset.StringSet{}
+	for _, h := range set.history {
+		if h.from < since {
+			continue
+		}
+		// Compose diffs, so that a DID added and then removed again
+		// doesn't show up at all.
+		for did := range h.diff.Added {
+			if removed[did] {
+				delete(removed, did)
+			} else {
+				added[did] = true
+			}
+		}
+		for did := range h.diff.Removed {
+			if added[did] {
+				delete(added, did)
+			} else {
+				removed[did] = true
+			}
+		}
+	}
+	set.mu.Unlock()
+
+	writeJSON(w, diffResponse{
+		Version: s.versionString(version),
+		Added:   sortedDIDs(added),
+		Removed: sortedDIDs(removed),
+	})
+}
+
+func sortedDIDs(set didset.StringSet) []string {
+	r := make([]string, 0, len(set))
+	for did := range set {
+		r = append(r, did)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,154 @@
+package didset
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// Weighted is a set together with its weight, for use with WeightedThreshold.
+type Weighted struct {
+	Set    DIDSet
+	Weight float64
+}
+
+type threshold struct {
+	sets []Weighted
+	min  float64
+}
+
+// Threshold returns DIDs that are members of at least k of the given sets.
+// The result implements QueryableDIDSet only if all of the sets do.
+func Threshold(k int, sets ...DIDSet) DIDSet {
+	weighted := make([]Weighted, 0, len(sets))
+	for _, s := range sets {
+		weighted = append(weighted, Weighted{Set: s, Weight: 1})
+	}
+	return WeightedThreshold(float64(k), weighted...)
+}
+
+// WeightedThreshold returns DIDs for which the total weight of sets
+// they are members of is at least min. The result implements QueryableDIDSet
+// only if all of the sets do.
+func WeightedThreshold(min float64, sets ...Weighted) DIDSet {
+	t := &threshold{sets: sets, min: min}
+	return queryableIf(t, t.setList()...)
+}
+
+func (t *threshold) GetDIDs(ctx context.Context) (StringSet, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "didset").
+		Str("didset", "threshold").
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	scores := map[string]float64{}
+	for i, s := range t.sets {
+		entries, err := s.Set.GetDIDs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %d'th set of threshold: %w", i, err)
+		}
+		for did := range entries {
+			scores[did] += s.Weight
+		}
+	}
+
+	r := StringSet{}
+	for did, score := range scores {
+		if score >= t.min {
+			r[did] = true
+		}
+	}
+	log.Trace().Msgf("Got %d dids", len(r))
+
+	return r, nil
+}
+
+func (t *threshold) Contains(ctx context.Context, did string) (bool, error) {
+	// Bounds of the total weight of sets that are not checked yet.
+	lower, upper := 0.0, 0.0
+	for _, s := range t.sets {
+		if s.Weight < 0 {
+			lower += s.Weight
+		} else {
+			upper += s.Weight
+		}
+	}
+
+	score := 0.0
+	found := false
+	for i, s := range t.sets {
+		if s.Weight < 0 {
+			lower -= s.Weight
+		} else {
+			upper -= s.Weight
+		}
+		r, err := contains(ctx, s.Set, did)
+		if err != nil {
+			return false, fmt.Errorf("evaluating %d'th set of threshold: %w", i, err)
+		}
+		if r {
+			found = true
+			score += s.Weight
+		}
+		// found is required to match GetDIDs, which only returns members of at least one set.
+		if found && score+lower >= t.min {
+			return true, nil
+		}
+		if score+upper < t.min {
+			return false, nil
+		}
+	}
+	return found && score >= t.min, nil
+}
+
+func (t *threshold) GetAnnotated(ctx context.Context) (map[string][]string, error) {
+	scores := map[string]float64{}
+	r := map[string][]string{}
+	for i, s := range t.sets {
+		entries, err := getAnnotated(ctx, s.Set)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %d'th set of threshold: %w", i, err)
+		}
+		for did, sources := range entries {
+			scores[did] += s.Weight
+			r[did] = mergeSources(r[did], sources)
+		}
+	}
+	for did, score := range scores {
+		if score < t.min {
+			delete(r, did)
+		}
+	}
+	return r, nil
+}
+
+func (t *threshold) Explain(ctx context.Context, did string) ([]string, bool, error) {
+	var r []string
+	score := 0.0
+	found := false
+	for i, s := range t.sets {
+		sources, ok, err := Explain(ctx, s.Set, did)
+		if err != nil {
+			return nil, false, fmt.Errorf("evaluating %d'th set of threshold: %w", i, err)
+		}
+		if ok {
+			found = true
+			score += s.Weight
+			r = mergeSources(r, sources)
+		}
+	}
+	if !found || score < t.min {
+		return nil, false, nil
+	}
+	return r, true, nil
+}
+
+func (t *threshold) setList() []DIDSet {
+	r := make([]DIDSet, 0, len(t.sets))
+	for _, s := range t.sets {
+		r = append(r, s.Set)
+	}
+	return r
+}
@@ -0,0 +1,92 @@
+package didset
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// notQueryable hides Contains of the wrapped set.
+type notQueryable struct {
+	set DIDSet
+}
+
+func (s notQueryable) GetDIDs(ctx context.Context) (StringSet, error) {
+	return s.set.GetDIDs(ctx)
+}
+
+func TestThresholdContains(t *testing.T) {
+	a := Const("did:plc:a", "did:plc:b", "did:plc:c")
+	b := Const("did:plc:b", "did:plc:c", "did:plc:d")
+	c := Const("did:plc:c", "did:plc:d", "did:plc:e")
+	universe := []string{"did:plc:a", "did:plc:b", "did:plc:c", "did:plc:d", "did:plc:e", "did:plc:f"}
+
+	tests := []struct {
+		name    string
+		min     float64
+		weights []float64
+		// hide makes the corresponding set non-queryable.
+		hide []bool
+		want []string
+	}{
+		{name: "at least 2", min: 2, weights: []float64{1, 1, 1},
+			want: []string{"did:plc:b", "did:plc:c", "did:plc:d"}},
+		{name: "min above total", min: 4, weights: []float64{1, 1, 1},
+			want: []string{}},
+		{name: "negative weight", min: 2, weights: []float64{2, 1, -1},
+			want: []string{"did:plc:a", "did:plc:b", "did:plc:c"}},
+		{name: "zero min", min: 0, weights: []float64{1, -2, 1},
+			want: []string{"did:plc:a", "did:plc:c", "did:plc:e"}},
+		{name: "all negative", min: -1.5, weights: []float64{-1, -1, -1},
+			want: []string{"did:plc:a", "did:plc:e"}},
+		{name: "fractional", min: 1, weights: []float64{0.5, 0.5, -3},
+			want: []string{"did:plc:b"}},
+		{name: "non-queryable", min: 1, weights: []float64{1, -1, 1}, hide: []bool{false, true, false},
+			want: []string{"did:plc:a", "did:plc:c", "did:plc:e"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			weighted := []Weighted{}
+			for i, s := range []DIDSet{a, b, c} {
+				if i < len(tc.hide) && tc.hide[i] {
+					s = notQueryable{s}
+				}
+				weighted = append(weighted, Weighted{Set: s, Weight: tc.weights[i]})
+			}
+			set := WeightedThreshold(tc.min, weighted...)
+
+			got, err := set.GetDIDs(ctx)
+			if err != nil {
+				t.Fatalf("GetDIDs: %s", err)
+			}
+			if diff := compareSets(got, tc.want); diff != "" {
+				t.Errorf("GetDIDs: %s", diff)
+			}
+			q, ok := set.(QueryableDIDSet)
+			if hidden := slices.Contains(tc.hide, true); ok == hidden {
+				t.Fatalf("implements QueryableDIDSet: got %v, want %v", ok, !hidden)
+			}
+			if !ok {
+				return
+			}
+			for _, did := range universe {
+				r, err := q.Contains(ctx, did)
+				if err != nil {
+					t.Fatalf("Contains(%q): %s", did, err)
+				}
+				if r != got[did] {
+					t.Errorf("Contains(%q) = %v, but GetDIDs %s", did, r, membership(got[did]))
+				}
+			}
+		})
+	}
+}
+
+func membership(member bool) string {
+	if member {
+		return "includes it"
+	}
+	return "doesn't include it"
+}
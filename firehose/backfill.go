@@ -0,0 +1,243 @@
+package firehose
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/didset"
+)
+
+// Backfill downloads complete repos of all accounts in a DID set and feeds
+// every record into the hooks as a synthetic "create" op, so that the same
+// hooks can be used both for the live firehose and for existing records.
+//
+// Unlike Firehose, actions are invoked synchronously, so Concurrency
+// also limits the number of concurrently running actions.
+type Backfill struct {
+	Hooks []Hook
+
+	// Concurrency is the number of repos processed in parallel.
+	Concurrency int
+	// ProgressFile, if not empty, is used to record DIDs of repos that
+	// were fully processed. They are skipped when the backfill is restarted.
+	ProgressFile string
+
+	client *xrpc.Client
+	set    didset.DIDSet
+
+	progressMu sync.Mutex
+}
+
+func NewBackfill(client *xrpc.Client, set didset.DIDSet) *Backfill {
+	return &Backfill{
+		client:      client,
+		set:         set,
+		Concurrency: 4,
+	}
+}
+
+func (b *Backfill) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx).With().Str("module", "backfill").Logger()
+	ctx = log.WithContext(ctx)
+
+	dids, err := b.set.GetDIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching the list of DIDs: %w", err)
+	}
+
+	done, err := b.readProgress()
+	if err != nil {
+		return err
+	}
+	for did := range done {
+		delete(dids, did)
+	}
+	log.Info().Msgf("Backfilling %d repos (%d already done)", len(dids), len(done))
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	var progressErr error
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for did := range queue {
+				if err := b.processRepo(ctx, did); err != nil {
+					log.Error().Err(err).Str("repo", did).Msgf("Failed to backfill repo")
+					mu.Lock()
+					failed++
+					mu.Unlock()
+					continue
+				}
+				if err := b.markDone(did); err != nil {
+					mu.Lock()
+					progressErr = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+loop:
+	for did := range dids {
+		select {
+		case queue <- did:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if progressErr != nil {
+		return progressErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to backfill %d out of %d repos", failed, len(dids))
+	}
+	return nil
+}
+
+func (b *Backfill) processRepo(ctx context.Context, did string) error {
+	log := zerolog.Ctx(ctx).With().Str("repo", did).Logger()
+
+	car, err := comatproto.SyncGetRepo(ctx, b.client, did, "")
+	if err != nil {
+		return fmt.Errorf("com.atproto.sync.getRepo: %w", err)
+	}
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	root, err := repo.IngestRepo(ctx, bs, bytes.NewReader(car))
+	if err != nil {
+		return fmt.Errorf("IngestRepo: %w", err)
+	}
+	repo_, err := repo.OpenRepo(ctx, bs, root)
+	if err != nil {
+		return fmt.Errorf("OpenRepo: %w", err)
+	}
+
+	commit := &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   did,
+		Commit: lexutil.LexLink(root),
+		Rev:    repo_.SignedCommit().Rev,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	count := 0
+	err = repo_.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, rec, err := repo_.GetRecord(ctx, k)
+		if err != nil {
+			log.Trace().Err(err).Msgf("GetRecord(%q)", k)
+			return nil
+		}
+		c := lexutil.LexLink(v)
+		op := &comatproto.SyncSubscribeRepos_RepoOp{
+			Action: "create",
+			Path:   k,
+			Cid:    &c,
+		}
+
+		for i, hook := range b.Hooks {
+			if hook.Action == nil {
+				continue
+			}
+			// Recover from panics in each hook separately, so that
+			// the remaining hooks still get the record.
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						log.Error().Msgf("Backfill hook %d has panicked on %q: %+v", i, k, err)
+					}
+				}()
+				if hook.Predicate == nil || hook.Predicate(ctx, commit, op, rec) {
+					hook.Action(ctx, commit, op, rec)
+				}
+			}()
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterating over records: %w", err)
+	}
+	log.Debug().Msgf("Processed %d records", count)
+	return nil
+}
+
+func (b *Backfill) readProgress() (map[string]bool, error) {
+	r := map[string]bool{}
+	if b.ProgressFile == "" {
+		return r, nil
+	}
+
+	f, err := os.Open(b.ProgressFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("opening progress file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		did := strings.TrimSpace(scanner.Text())
+		if did != "" {
+			r[did] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading progress file: %w", err)
+	}
+	return r, nil
+}
+
+func (b *Backfill) markDone(did string) error {
+	if b.ProgressFile == "" {
+		return nil
+	}
+
+	b.progressMu.Lock()
+	defer b.progressMu.Unlock()
+
+	f, err := os.OpenFile(b.ProgressFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening progress file: %w", err)
+	}
+	if _, err := fmt.Fprintln(f, did); err != nil {
+		f.Close()
+		return fmt.Errorf("writing progress file: %w", err)
+	}
+	return f.Close()
+}
@@ -30,9 +30,19 @@ type Firehose struct {
 
 type Predicate func(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) bool
 
+type Action func(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler)
+
 type Hook struct {
 	Predicate Predicate
-	Action    func(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler)
+	Action    Action
+	// Deletes enables calling the hook for delete ops too. Deleted records
+	// are not included in the commit, so both Predicate and Action get
+	// a nil record for them.
+	Deletes bool
+	// Synchronous makes the firehose call Action directly instead of in
+	// a new goroutine, so that it sees ops in commit order. Such actions
+	// delay processing of the following ops, so they must be fast.
+	Synchronous bool
 }
 
 func New() *Firehose {
@@ -51,8 +61,11 @@ func (f *Firehose) Run(ctx context.Context) error {
 			q.Add("cursor", fmt.Sprint(f.seq))
 			addr.RawQuery = q.Encode()
 		}
-		conn, _, err := websocket.DefaultDialer.Dial(addr.String(), http.Header{})
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, addr.String(), http.Header{})
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			log.Error().Err(err).Msgf("websocket dial error")
 			time.Sleep(5 * time.Second)
 			continue
@@ -81,6 +94,11 @@ func (f *Firehose) Run(ctx context.Context) error {
 				}
 				for _, op := range e.Ops {
 					log.Trace().Interface("op", op).Msg("Op")
+					if op.Action == "delete" {
+						f.callHooks(ctx, e, op, nil)
+						continue
+					}
+
 					collection := strings.Split(op.Path, "/")[0]
 					rcid, rec, err := repo_.GetRecord(ctx, op.Path)
 					if err != nil {
@@ -100,14 +118,7 @@ func (f *Firehose) Run(ctx context.Context) error {
 						log.Info().Err(fmt.Errorf("mismatch in record op and cid: %s != %s", rcid, *op.Cid))
 					}
 
-					for _, hook := range f.Hooks {
-						if hook.Action == nil {
-							continue
-						}
-						if hook.Predicate == nil || hook.Predicate(ctx, e, op, rec) {
-							go hook.Action(ctx, e, op, rec)
-						}
-					}
+					f.callHooks(ctx, e, op, rec)
 				}
 				return nil
 			},
@@ -126,3 +137,19 @@ func (f *Firehose) Run(ctx context.Context) error {
 
 	return ctx.Err()
 }
+
+func (f *Firehose) callHooks(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) {
+	for _, hook := range f.Hooks {
+		if hook.Action == nil || op.Action == "delete" && !hook.Deletes {
+			continue
+		}
+		if hook.Predicate != nil && !hook.Predicate(ctx, commit, op, record) {
+			continue
+		}
+		if hook.Synchronous {
+			hook.Action(ctx, commit, op, record)
+		} else {
+			go hook.Action(ctx, commit, op, record)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type FileConfig struct {
+	Path string `json:"path"`
+	// MaxSize is the size in bytes after which the file gets rotated.
+	// Zero disables rotation.
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// File appends events to a file as newline-delimited JSON. When the file
+// grows above the configured size, it is renamed to "<path>.<timestamp>"
+// and a new file is started.
+type File struct {
+	cfg FileConfig
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func NewFile(cfg FileConfig) (*File, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("file path is missing")
+	}
+	r := &File{cfg: cfg}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", f.cfg.Path, err)
+	}
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat %q: %w", f.cfg.Path, err)
+	}
+	f.f = file
+	f.size = st.Size()
+	return nil
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("closing %q: %w", f.cfg.Path, err)
+	}
+	f.f = nil
+	rotated := fmt.Sprintf("%s.%s", f.cfg.Path, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(f.cfg.Path, rotated); err != nil {
+		return fmt.Errorf("renaming %q: %w", f.cfg.Path, err)
+	}
+	return f.open()
+}
+
+func (f *File) Write(ctx context.Context, event *Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshaling event: %w", err)
+	}
+	b = append(b, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		// Previous rotation has failed, try again.
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.cfg.MaxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.cfg.MaxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.f.Write(b)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing into %q: %w", f.cfg.Path, err)
+	}
+	return nil
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
@@ -0,0 +1,124 @@
+// Package sink provides ready-made firehose actions that forward matched
+// events to external destinations.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/firehose"
+)
+
+// Event is a JSON-friendly representation of a single firehose op.
+type Event struct {
+	Seq        int64       `json:"seq"`
+	Repo       string      `json:"repo"`
+	Rev        string      `json:"rev,omitempty"`
+	Time       string      `json:"time"`
+	Action     string      `json:"action"`
+	Collection string      `json:"collection"`
+	Rkey       string      `json:"rkey"`
+	Cid        string      `json:"cid,omitempty"`
+	URI        string      `json:"uri"`
+	URL        string      `json:"url"`
+	Record     interface{} `json:"record,omitempty"`
+}
+
+func NewEvent(commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) *Event {
+	r := &Event{
+		Seq:    commit.Seq,
+		Repo:   commit.Repo,
+		Rev:    commit.Rev,
+		Time:   commit.Time,
+		Action: op.Action,
+		URI:    firehose.RecordURI(commit, op),
+		URL:    firehose.RecordURL(commit, op, record),
+	}
+	r.Collection, r.Rkey, _ = strings.Cut(op.Path, "/")
+	if op.Cid != nil {
+		r.Cid = op.Cid.String()
+	}
+	if record != nil {
+		r.Record = record
+	}
+	return r
+}
+
+// Sink is a destination for events.
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+	Close() error
+}
+
+// Action returns a firehose action that writes every event into the sink.
+// Errors are logged, since actions have no way to return them.
+// Set Deletes on the hook to record delete ops too.
+func Action(s Sink) firehose.Action {
+	return func(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) {
+		log := zerolog.Ctx(ctx).With().Str("module", "sink").Logger()
+		if err := s.Write(ctx, NewEvent(commit, op, record)); err != nil {
+			log.Error().Err(err).Msgf("Failed to write event for %s", firehose.RecordURI(commit, op))
+		}
+	}
+}
+
+// Config describes a sink. Exactly one of the fields must be set.
+type Config struct {
+	Webhook *WebhookConfig `json:"webhook,omitempty"`
+	File    *FileConfig    `json:"file,omitempty"`
+	SQLite  *SQLiteConfig  `json:"sqlite,omitempty"`
+}
+
+// New creates a sink described by the config.
+func New(cfg Config) (Sink, error) {
+	n := 0
+	for _, set := range []bool{cfg.Webhook != nil, cfg.File != nil, cfg.SQLite != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("exactly one sink type must be specified, got %d", n)
+	}
+
+	switch {
+	case cfg.Webhook != nil:
+		return NewWebhook(*cfg.Webhook)
+	case cfg.File != nil:
+		return NewFile(*cfg.File)
+	default:
+		return NewSQLite(*cfg.SQLite)
+	}
+}
+
+// Multi returns a sink that writes every event into all of the given sinks.
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+type multi []Sink
+
+func (m multi) Write(ctx context.Context, event *Event) error {
+	errs := []error{}
+	for i, s := range m {
+		if err := s.Write(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("writing into %d'th sink: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) Close() error {
+	errs := []error{}
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SQLiteConfig struct {
+	Path string `json:"path"`
+	// Table defaults to "firehose_events".
+	Table string `json:"table,omitempty"`
+}
+
+// SQLite inserts events into a table with the following schema, which
+// is created if it doesn't exist yet:
+//
+//	id          INTEGER PRIMARY KEY AUTOINCREMENT
+//	seq         INTEGER NOT NULL
+//	repo        TEXT NOT NULL
+//	rev         TEXT NOT NULL
+//	time        TEXT NOT NULL
+//	action      TEXT NOT NULL
+//	collection  TEXT NOT NULL
+//	rkey        TEXT NOT NULL
+//	cid         TEXT NOT NULL
+//	uri         TEXT NOT NULL
+//	url         TEXT NOT NULL
+//	record      TEXT            -- JSON, NULL for deletes
+//	received_at TEXT NOT NULL   -- RFC 3339
+type SQLite struct {
+	db     *sql.DB
+	insert *sql.Stmt
+}
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func NewSQLite(cfg SQLiteConfig) (*SQLite, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("database path is missing")
+	}
+	if cfg.Table == "" {
+		cfg.Table = "firehose_events"
+	}
+	if !tableNameRegexp.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("invalid table name %q", cfg.Table)
+	}
+
+	db, err := sql.Open("sqlite3", cfg.Path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("opening %q: %w", cfg.Path, err)
+	}
+	// SQLite doesn't support concurrent writers anyway.
+	db.SetMaxOpenConns(1)
+
+	stmts := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			seq INTEGER NOT NULL,
+			repo TEXT NOT NULL,
+			rev TEXT NOT NULL,
+			time TEXT NOT NULL,
+			action TEXT NOT NULL,
+			collection TEXT NOT NULL,
+			rkey TEXT NOT NULL,
+			cid TEXT NOT NULL,
+			uri TEXT NOT NULL,
+			url TEXT NOT NULL,
+			record TEXT,
+			received_at TEXT NOT NULL
+		)`, cfg.Table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_repo ON %[1]s (repo)`, cfg.Table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_collection ON %[1]s (collection)`, cfg.Table),
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating schema: %w", err)
+		}
+	}
+
+	insert, err := db.Prepare(fmt.Sprintf(`INSERT INTO %s
+		(seq, repo, rev, time, action, collection, rkey, cid, uri, url, record, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, cfg.Table))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("preparing insert statement: %w", err)
+	}
+
+	return &SQLite{db: db, insert: insert}, nil
+}
+
+func (s *SQLite) Write(ctx context.Context, event *Event) error {
+	var record sql.NullString
+	if event.Record != nil {
+		b, err := json.Marshal(event.Record)
+		if err != nil {
+			return fmt.Errorf("marshaling record: %w", err)
+		}
+		record = sql.NullString{String: string(b), Valid: true}
+	}
+
+	_, err := s.insert.ExecContext(ctx,
+		event.Seq, event.Repo, event.Rev, event.Time, event.Action,
+		event.Collection, event.Rkey, event.Cid, event.URI, event.URL,
+		record, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("inserting event: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	s.insert.Close()
+	return s.db.Close()
+}
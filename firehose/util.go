@@ -5,10 +5,100 @@ import (
 	"strings"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/aturl"
 )
 
-func FeedPostURL(commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp) string {
-	repo := commit.Repo
-	id := strings.TrimPrefix(op.Path, strings.Split(op.Path, "/")[0]+"/")
-	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", repo, id)
+// RecordURL returns a web URL that is most useful for a human looking at the op:
+//
+//   - posts, lists, feed generators and starter packs link to the record itself
+//   - likes and reposts link to the liked/reposted record
+//   - follows and blocks link to the profile of the subject
+//   - list items link to the list
+//   - anything else links to the profile of the repo owner
+//
+// record can be nil (e.g., for delete ops), in which case it falls back to
+// the profile of the repo owner for record types that need it.
+func RecordURL(commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) string {
+	return RecordURLForProfile(commit.Repo, op, record)
+}
+
+// RecordURLForProfile is the same as RecordURL, but uses the given profile
+// (DID or handle) instead of the repo DID.
+func RecordURLForProfile(profile string, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) string {
+	collection, rkey := splitPath(op.Path)
+
+	switch rec := record.(type) {
+	case *bsky.FeedLike:
+		if rec.Subject != nil {
+			if u := webURLFromURI(rec.Subject.Uri); u != "" {
+				return u
+			}
+		}
+	case *bsky.FeedRepost:
+		if rec.Subject != nil {
+			if u := webURLFromURI(rec.Subject.Uri); u != "" {
+				return u
+			}
+		}
+	case *bsky.GraphFollow:
+		return webURL(rec.Subject, "", "")
+	case *bsky.GraphBlock:
+		return webURL(rec.Subject, "", "")
+	case *bsky.GraphListitem:
+		if u := webURLFromURI(rec.List); u != "" {
+			return u
+		}
+	case *bsky.GraphListblock:
+		if u := webURLFromURI(rec.Subject); u != "" {
+			return u
+		}
+	}
+
+	return webURL(profile, collection, rkey)
+}
+
+// RecordURI returns at:// URI of the record affected by the op.
+func RecordURI(commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp) string {
+	return RecordURIForProfile(commit.Repo, op)
+}
+
+// RecordURIForProfile is the same as RecordURI, but uses the given profile
+// (DID or handle) instead of the repo DID.
+func RecordURIForProfile(profile string, op *comatproto.SyncSubscribeRepos_RepoOp) string {
+	return fmt.Sprintf("at://%s/%s", profile, op.Path)
+}
+
+func splitPath(path string) (collection string, rkey string) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func webURLFromURI(uri string) string {
+	u, err := aturl.Parse(uri)
+	if err != nil || u.Scheme != "at" || u.Host == "" {
+		return ""
+	}
+	collection, rkey := splitPath(strings.Trim(u.Path, "/"))
+	return webURL(u.Host, collection, rkey)
+}
+
+func webURL(profile string, collection string, rkey string) string {
+	switch {
+	case rkey == "":
+	case collection == "app.bsky.feed.post":
+		return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", profile, rkey)
+	case collection == "app.bsky.graph.list":
+		return fmt.Sprintf("https://bsky.app/profile/%s/lists/%s", profile, rkey)
+	case collection == "app.bsky.feed.generator":
+		return fmt.Sprintf("https://bsky.app/profile/%s/feed/%s", profile, rkey)
+	case collection == "app.bsky.graph.starterpack":
+		return fmt.Sprintf("https://bsky.app/starter-pack/%s/%s", profile, rkey)
+	}
+	return fmt.Sprintf("https://bsky.app/profile/%s", profile)
 }
@@ -0,0 +1,55 @@
+// Package httpserver runs an HTTP server together with the background
+// tasks it depends on, and shuts everything down together.
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ShutdownTimeout is how long in-flight requests are given to complete
+// once the server is stopping.
+var ShutdownTimeout = 5 * time.Second
+
+// Run serves HTTP requests with srv and runs every task in its own goroutine,
+// until ctx is done, the server fails (e.g., the address is already in use),
+// or any of the tasks returns. In the latter two cases the context passed to
+// the tasks and to request handlers is cancelled, and the error is returned.
+// srv.BaseContext is overwritten.
+func Run(ctx context.Context, srv *http.Server, tasks ...func(ctx context.Context) error) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv.BaseContext = func(_ net.Listener) context.Context { return ctx }
+
+	errCh := make(chan error, len(tasks)+1)
+	for _, task := range tasks {
+		go func(task func(ctx context.Context) error) {
+			errCh <- task(ctx)
+		}(task)
+	}
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+	}
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancelShutdown()
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = fmt.Errorf("shutting down HTTP server: %w", shutdownErr)
+	}
+	if err == nil {
+		err = parent.Err()
+	}
+	return err
+}
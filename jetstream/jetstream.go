@@ -0,0 +1,340 @@
+// Package jetstream re-publishes commits from the firehose as JSON over
+// websocket, using the same wire format as https://github.com/bluesky-social/jetstream.
+//
+// Clients connect to /subscribe and can pass the following query parameters:
+//
+//   - wantedCollections: collection NSIDs to receive, can be repeated. A trailing
+//     ".*" matches any collection with the given prefix, e.g. "app.bsky.graph.*".
+//   - wantedDids: repo DIDs to receive, can be repeated.
+//   - cursor: unix timestamp in microseconds. Events that were received at or
+//     after that time are replayed first, as long as they are still in the buffer.
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/firehose"
+	"github.com/uabluerail/bsky-tools/httpserver"
+)
+
+const (
+	maxWantedCollections = 100
+	maxWantedDids        = 10000
+)
+
+type Event struct {
+	Did    string  `json:"did"`
+	TimeUS int64   `json:"time_us"`
+	Kind   string  `json:"kind"`
+	Commit *Commit `json:"commit,omitempty"`
+}
+
+type Commit struct {
+	Rev        string      `json:"rev"`
+	Operation  string      `json:"operation"`
+	Collection string      `json:"collection"`
+	Rkey       string      `json:"rkey"`
+	Record     interface{} `json:"record,omitempty"`
+	Cid        string      `json:"cid,omitempty"`
+}
+
+type Server struct {
+	// BufferSize is the number of recent events kept in memory for replaying
+	// to clients that connect with a cursor.
+	BufferSize int
+	// ClientQueueSize is the number of events that can be queued for a single client.
+	// Clients that fall behind more than that are disconnected. While a client
+	// is replaying buffered events, new ones are queued up to BufferSize instead.
+	ClientQueueSize int
+
+	firehose *firehose.Firehose
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	buffer   []*encodedEvent
+	start    int
+	lastTime int64
+	clients  map[*client]bool
+}
+
+type encodedEvent struct {
+	did        string
+	collection string
+	timeUS     int64
+	data       []byte
+}
+
+// New creates a server and registers a hook on f. It must be called before f.Run().
+func New(f *firehose.Firehose) *Server {
+	s := &Server{
+		BufferSize:      100000,
+		ClientQueueSize: 10000,
+		firehose:        f,
+		clients:         map[*client]bool{},
+	}
+	f.Hooks = append(f.Hooks, firehose.Hook{Action: s.publish, Deletes: true, Synchronous: true})
+	return s
+}
+
+// Run starts both the firehose and an HTTP server listening on addr.
+// If either of them stops, the other one is stopped too.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	log := zerolog.Ctx(ctx).With().Str("module", "jetstream").Logger()
+	ctx = log.WithContext(ctx)
+
+	return httpserver.Run(ctx, &http.Server{Addr: addr, Handler: s}, s.firehose.Run)
+}
+
+func (s *Server) publish(ctx context.Context, commit *comatproto.SyncSubscribeRepos_Commit, op *comatproto.SyncSubscribeRepos_RepoOp, record cbg.CBORMarshaler) {
+	log := zerolog.Ctx(ctx)
+
+	collection, rkey, _ := strings.Cut(op.Path, "/")
+	evt := &Event{
+		Did:  commit.Repo,
+		Kind: "commit",
+		Commit: &Commit{
+			Rev:        commit.Rev,
+			Operation:  op.Action,
+			Collection: collection,
+			Rkey:       rkey,
+		},
+	}
+	if op.Cid != nil {
+		evt.Commit.Cid = op.Cid.String()
+	}
+	if op.Action != "delete" && record != nil {
+		evt.Commit.Record = record
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Commit time is used, but adjusted to be strictly increasing, since
+	// cursors rely on that. Times in the future are not trusted.
+	now := time.Now()
+	t, err := time.Parse(time.RFC3339, commit.Time)
+	if err != nil || t.After(now) {
+		t = now
+	}
+	evt.TimeUS = t.UnixMicro()
+	if evt.TimeUS <= s.lastTime {
+		evt.TimeUS = s.lastTime + 1
+	}
+	s.lastTime = evt.TimeUS
+
+	data, err := json.Marshal(evt)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to marshal event for %s", firehose.RecordURI(commit, op))
+		return
+	}
+	e := &encodedEvent{did: commit.Repo, collection: collection, timeUS: evt.TimeUS, data: data}
+
+	if s.BufferSize > 0 {
+		if len(s.buffer) < s.BufferSize {
+			s.buffer = append(s.buffer, e)
+		} else {
+			s.buffer[s.start] = e
+			s.start = (s.start + 1) % len(s.buffer)
+		}
+	}
+
+	for c := range s.clients {
+		if !c.wants(e) {
+			continue
+		}
+		if c.replaying {
+			if len(c.backlog) >= max(s.BufferSize, s.ClientQueueSize) {
+				delete(s.clients, c)
+				close(c.queue)
+				continue
+			}
+			c.backlog = append(c.backlog, e.data)
+			continue
+		}
+		select {
+		case c.queue <- e.data:
+		default:
+			delete(s.clients, c)
+			close(c.queue)
+		}
+	}
+}
+
+// replayFrom returns buffered events with timestamp at or after cursor.
+// Must be called with s.mu held.
+func (s *Server) replayFrom(cursor int64, c *client) [][]byte {
+	r := [][]byte{}
+	for i := 0; i < len(s.buffer); i++ {
+		e := s.buffer[(s.start+i)%len(s.buffer)]
+		if e.timeUS >= cursor && c.wants(e) {
+			r = append(r, e.data)
+		}
+	}
+	return r
+}
+
+type client struct {
+	collections map[string]bool
+	prefixes    []string
+	dids        map[string]bool
+	queue       chan []byte
+
+	// replaying is set while buffered events are being sent to the client.
+	// Meanwhile new events are appended to backlog instead of queue.
+	// Both are protected by Server.mu.
+	replaying bool
+	backlog   [][]byte
+}
+
+func (c *client) wants(e *encodedEvent) bool {
+	if len(c.dids) > 0 && !c.dids[e.did] {
+		return false
+	}
+	if len(c.collections) == 0 && len(c.prefixes) == 0 {
+		return true
+	}
+	if c.collections[e.collection] {
+		return true
+	}
+	for _, p := range c.prefixes {
+		if strings.HasPrefix(e.collection, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/subscribe" {
+		http.NotFound(w, r)
+		return
+	}
+	log := zerolog.Ctx(r.Context()).With().Str("remote_addr", r.RemoteAddr).Logger()
+
+	q := r.URL.Query()
+	c := &client{
+		collections: map[string]bool{},
+		dids:        map[string]bool{},
+		queue:       make(chan []byte, s.ClientQueueSize),
+	}
+	if len(q["wantedCollections"]) > maxWantedCollections {
+		http.Error(w, fmt.Sprintf("too many wantedCollections (max %d)", maxWantedCollections), http.StatusBadRequest)
+		return
+	}
+	for _, col := range q["wantedCollections"] {
+		if p, ok := strings.CutSuffix(col, ".*"); ok {
+			c.prefixes = append(c.prefixes, p+".")
+		} else {
+			c.collections[col] = true
+		}
+	}
+	if len(q["wantedDids"]) > maxWantedDids {
+		http.Error(w, fmt.Sprintf("too many wantedDids (max %d)", maxWantedDids), http.StatusBadRequest)
+		return
+	}
+	for _, did := range q["wantedDids"] {
+		c.dids[did] = true
+	}
+	var cursor int64
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		cursor, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid cursor: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Debug().Err(err).Msgf("Websocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	var replay [][]byte
+	if cursor > 0 {
+		replay = s.replayFrom(cursor, c)
+		c.replaying = true
+	}
+	s.clients[c] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.clients[c] {
+			delete(s.clients, c)
+			close(c.queue)
+		}
+		s.mu.Unlock()
+	}()
+
+	// Read (and discard) incoming messages to notice when the client goes away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(data []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	for c.replaying {
+		for _, data := range replay {
+			if err := send(data); err != nil {
+				log.Debug().Err(err).Msgf("Write failed")
+				return
+			}
+		}
+		// Send events that arrived during the replay, until we catch up.
+		s.mu.Lock()
+		replay = c.backlog
+		c.backlog = nil
+		if len(replay) == 0 || !s.clients[c] {
+			// If the client was dropped for being too slow, the queue
+			// is already closed and the loop below will report it.
+			c.replaying = false
+		}
+		s.mu.Unlock()
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		case data, ok := <-c.queue:
+			if !ok {
+				log.Debug().Msgf("Client is too slow, disconnecting")
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow"),
+					time.Now().Add(time.Second))
+				return
+			}
+			if err := send(data); err != nil {
+				log.Debug().Err(err).Msgf("Write failed")
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	cbg "github.com/whyrusleeping/cbor-gen"
+
+	"github.com/uabluerail/bsky-tools/labelstream"
+)
+
+func main() {
+	if err := cbg.WriteMapEncodersToFile("cbor_gen.go", "labelstream", labelstream.Label{}, labelstream.Labels{}, labelstream.Info{}); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,218 @@
+// Package labelstream consumes com.atproto.label.subscribeLabels streams
+// from labelers, in the same way as package firehose consumes repo commits.
+package labelstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/uabluerail/bsky-tools/atomicfile"
+)
+
+type Stream struct {
+	Hooks []Hook
+
+	// CursorFile, if not empty, is used to persist the sequence number of
+	// the last received event, so that the stream can be resumed after restart.
+	CursorFile string
+
+	addr string
+	seq  int64
+}
+
+type Predicate func(ctx context.Context, label *Label) bool
+
+type Action func(ctx context.Context, label *Label)
+
+type Hook struct {
+	Predicate Predicate
+	Action    Action
+}
+
+// New creates a subscriber for the labeler running at the given host,
+// e.g. "mod.bsky.app" or "wss://mod.bsky.app".
+func New(host string) *Stream {
+	if !strings.Contains(host, "://") {
+		host = "wss://" + host
+	}
+	host = strings.Replace(host, "https://", "wss://", 1)
+	host = strings.Replace(host, "http://", "ws://", 1)
+	return &Stream{addr: strings.TrimSuffix(host, "/") + "/xrpc/com.atproto.label.subscribeLabels"}
+}
+
+func (s *Stream) Run(ctx context.Context) error {
+	log := zerolog.Ctx(ctx).With().Str("module", "labelstream").Str("addr", s.addr).Logger()
+	ctx = log.WithContext(ctx)
+
+	if err := s.loadCursor(); err != nil {
+		return err
+	}
+
+	for {
+		addr, err := url.Parse(s.addr)
+		if err != nil {
+			return fmt.Errorf("parsing URL %q: %w", s.addr, err)
+		}
+		if s.seq > 0 {
+			q := addr.Query()
+			q.Add("cursor", fmt.Sprint(s.seq))
+			addr.RawQuery = q.Encode()
+		}
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, addr.String(), http.Header{})
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Error().Err(err).Msgf("websocket dial error")
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		if err := s.handleStream(ctx, conn); err != nil {
+			log.Error().Err(err).Msgf("handleStream error")
+		}
+		conn.Close()
+		if err := s.saveCursor(); err != nil {
+			log.Error().Err(err).Msgf("Failed to save cursor")
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		time.Sleep(5 * time.Second)
+		log.Debug().Msgf("Restarting handleStream")
+	}
+
+	return ctx.Err()
+}
+
+func (s *Stream) handleStream(ctx context.Context, conn *websocket.Conn) error {
+	log := zerolog.Ctx(ctx)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	lastSaved := time.Now()
+	for {
+		_, b, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("reading from websocket: %w", err)
+		}
+		r := bytes.NewReader(b)
+
+		var header events.EventHeader
+		if err := header.UnmarshalCBOR(r); err != nil {
+			return fmt.Errorf("reading event header: %w", err)
+		}
+
+		switch header.Op {
+		case events.EvtKindMessage:
+			switch header.MsgType {
+			case "#labels":
+				var evt Labels
+				if err := evt.UnmarshalCBOR(r); err != nil {
+					return fmt.Errorf("reading #labels event: %w", err)
+				}
+				s.handleLabels(ctx, &evt)
+			case "#info":
+				var evt Info
+				if err := evt.UnmarshalCBOR(r); err != nil {
+					return fmt.Errorf("reading #info event: %w", err)
+				}
+				msg := ""
+				if evt.Message != nil {
+					msg = *evt.Message
+				}
+				log.Info().Str("name", evt.Name).Msgf("Info: %s", msg)
+			default:
+				log.Debug().Msgf("Ignoring unknown message type %q", header.MsgType)
+			}
+		case events.EvtKindErrorFrame:
+			var evt events.ErrorFrame
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("reading error frame: %w", err)
+			}
+			return fmt.Errorf("error frame: %s: %s", evt.Error, evt.Message)
+		default:
+			return fmt.Errorf("unrecognized event stream type: %d", header.Op)
+		}
+
+		if s.CursorFile != "" && time.Since(lastSaved) > 5*time.Second {
+			if err := s.saveCursor(); err != nil {
+				log.Error().Err(err).Msgf("Failed to save cursor")
+			}
+			lastSaved = time.Now()
+		}
+	}
+}
+
+func (s *Stream) handleLabels(ctx context.Context, evt *Labels) {
+	log := zerolog.Ctx(ctx).With().Int64("seq", evt.Seq).Logger()
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error().Msgf("Labels callback has panicked: %+v", err)
+		}
+	}()
+	s.seq = evt.Seq
+
+	for _, label := range evt.Labels {
+		if label == nil {
+			continue
+		}
+		log.Trace().Interface("label", label).Msg("Label")
+		for _, hook := range s.Hooks {
+			if hook.Action == nil {
+				continue
+			}
+			if hook.Predicate == nil || hook.Predicate(ctx, label) {
+				go hook.Action(ctx, label)
+			}
+		}
+	}
+}
+
+func (s *Stream) loadCursor() error {
+	if s.CursorFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.CursorFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading cursor file: %w", err)
+	}
+	seq, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing cursor file: %w", err)
+	}
+	s.seq = seq
+	return nil
+}
+
+func (s *Stream) saveCursor() error {
+	if s.CursorFile == "" || s.seq == 0 {
+		return nil
+	}
+	if err := atomicfile.WriteFile(s.CursorFile, []byte(fmt.Sprint(s.seq)), 0644); err != nil {
+		return fmt.Errorf("failed to save cursor: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package labelstream
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+func AllOf(predicates ...Predicate) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		for _, p := range predicates {
+			if !p(ctx, label) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func AnyOf(predicates ...Predicate) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		for _, p := range predicates {
+			if p(ctx, label) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(predicate Predicate) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return !predicate(ctx, label)
+	}
+}
+
+// FromSource matches labels created by the given labeler.
+func FromSource(did string) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return label.Src == did
+	}
+}
+
+// ForURI matches labels applied to exactly the given subject.
+func ForURI(uri string) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return label.Uri == uri
+	}
+}
+
+// ForAccount matches labels applied to the account itself.
+func ForAccount() Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return strings.HasPrefix(label.Uri, "did:")
+	}
+}
+
+// ForRecord matches labels applied to individual records.
+func ForRecord() Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return strings.HasPrefix(label.Uri, "at://")
+	}
+}
+
+// AboutDID matches labels applied either to the account or to any of its records.
+func AboutDID(did string) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return label.SubjectDID() == did
+	}
+}
+
+// HasValue matches labels with any of the given values.
+func HasValue(vals ...string) Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		for _, v := range vals {
+			if label.Val == v {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func IsNegation() Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return label.IsNegation()
+	}
+}
+
+// NotExpired matches labels that either have no expiration time or it's in the future.
+func NotExpired() Predicate {
+	return func(ctx context.Context, label *Label) bool {
+		return !label.ExpiredAt(time.Now())
+	}
+}
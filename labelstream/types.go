@@ -0,0 +1,74 @@
+package labelstream
+
+import (
+	"strings"
+	"time"
+
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+//go:generate go run ./gen
+
+// Label is com.atproto.label.defs#label. It's defined here instead of using
+// the type from indigo, because the latter is missing some of the fields
+// (most notably, "exp").
+type Label struct {
+	Src string           `json:"src" cborgen:"src"`
+	Uri string           `json:"uri" cborgen:"uri"`
+	Cid *string          `json:"cid,omitempty" cborgen:"cid,omitempty"`
+	Val string           `json:"val" cborgen:"val"`
+	Neg *bool            `json:"neg,omitempty" cborgen:"neg,omitempty"`
+	Cts string           `json:"cts" cborgen:"cts"`
+	Exp *string          `json:"exp,omitempty" cborgen:"exp,omitempty"`
+	Sig lexutil.LexBytes `json:"sig,omitempty" cborgen:"sig,omitempty"`
+}
+
+// Labels is com.atproto.label.subscribeLabels#labels.
+type Labels struct {
+	Seq    int64    `json:"seq" cborgen:"seq"`
+	Labels []*Label `json:"labels" cborgen:"labels"`
+}
+
+// IsNegation returns true if the label removes a previously applied label.
+func (l *Label) IsNegation() bool {
+	return l.Neg != nil && *l.Neg
+}
+
+// ExpiresAt returns the expiration time of the label, if it has one.
+func (l *Label) ExpiresAt() (time.Time, bool) {
+	if l.Exp == nil || *l.Exp == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, *l.Exp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ExpiredAt returns true if the label has an expiration time that is before t.
+func (l *Label) ExpiredAt(t time.Time) bool {
+	exp, ok := l.ExpiresAt()
+	return ok && exp.Before(t)
+}
+
+// CreatedAt returns the parsed value of "cts" field.
+func (l *Label) CreatedAt() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, l.Cts)
+}
+
+// SubjectDID returns the DID of the account that the label applies to,
+// either directly or via one of its records.
+func (l *Label) SubjectDID() string {
+	if strings.HasPrefix(l.Uri, "did:") {
+		return l.Uri
+	}
+	did, _, _ := strings.Cut(strings.TrimPrefix(l.Uri, "at://"), "/")
+	return did
+}
+
+// Info is com.atproto.label.subscribeLabels#info.
+type Info struct {
+	Name    string  `json:"name" cborgen:"name"`
+	Message *string `json:"message,omitempty" cborgen:"message,omitempty"`
+}
@@ -7,29 +7,48 @@ func Collect[T any](fn func(cursor string) (resp T, nextCursor string, err error
 	})
 }
 
+// Reduce calls fetch repeatedly, passing the cursor returned by the previous
+// call, and combines all responses into a single value. Every response is
+// passed to combine, including the last one. Iteration stops after a response
+// with an empty cursor, or with the same cursor as the one that was used
+// to fetch it (to avoid looping forever on misbehaving servers).
 func Reduce[T any, R any](
 	fetch func(cursor string) (resp T, nextCursor string, err error),
 	combine func(resp T, acc R) (R, error),
 ) (R, error) {
-	cursor := ""
 	var r R
+	err := ForEach(fetch, func(resp T) (bool, error) {
+		var err error
+		r, err = combine(resp, r)
+		return err == nil, err
+	})
+	return r, err
+}
+
+// ForEach is like Reduce, but passes every response to fn as soon as
+// it is fetched, without accumulating anything. Iteration also stops
+// if fn returns false or an error.
+func ForEach[T any](
+	fetch func(cursor string) (resp T, nextCursor string, err error),
+	fn func(resp T) (bool, error),
+) error {
+	cursor := ""
 
 	for {
 		resp, nextCursor, err := fetch(cursor)
 		if err != nil {
-			return r, err
+			return err
 		}
 
-		r, err = combine(resp, r)
+		more, err := fn(resp)
 		if err != nil {
-			return r, err
+			return err
 		}
 
-		if nextCursor == "" {
+		if !more || nextCursor == "" || nextCursor == cursor {
 			break
 		}
 		cursor = nextCursor
 	}
-	return r, nil
-
+	return nil
 }
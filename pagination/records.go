@@ -0,0 +1,33 @@
+package pagination
+
+import (
+	"context"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// ListRecords passes all records of the collection in repo to fn,
+// until it returns false.
+func ListRecords(ctx context.Context, client *xrpc.Client, repo string, collection string, fn func(rec *comatproto.RepoListRecords_Record) bool) error {
+	return ForEach(
+		func(cursor string) (resp *comatproto.RepoListRecords_Output, nextCursor string, err error) {
+			resp, err = comatproto.RepoListRecords(ctx, client, collection, cursor, 100, repo, false, "", "")
+			if err != nil {
+				return
+			}
+			if resp.Cursor != nil {
+				nextCursor = *resp.Cursor
+			}
+			return
+		},
+		func(resp *comatproto.RepoListRecords_Output) (bool, error) {
+			for _, rec := range resp.Records {
+				if !fn(rec) {
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+	)
+}
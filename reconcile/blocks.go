@@ -0,0 +1,206 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/atomicfile"
+	"github.com/uabluerail/bsky-tools/didset"
+	"github.com/uabluerail/bsky-tools/pagination"
+)
+
+// BlockSyncer makes the authenticated account block everyone in the DID set.
+// It keeps track of the blocks it has created in StateFile and only ever
+// deletes those, so blocks made by the user are left alone even if the account
+// is not in the set. If a block created by the syncer is removed by the user,
+// it is forgotten and created again on the next run if still needed.
+type BlockSyncer struct {
+	// StateFile is where the syncer keeps record keys of blocks it has created.
+	// Without it no blocks are ever deleted.
+	StateFile string
+	// DryRun disables all writes, including the state file. Planned changes are
+	// still logged and returned.
+	DryRun bool
+	// MaxChanges, if positive, makes Sync fail with ErrTooManyChanges
+	// instead of making more changes than that, also with DryRun.
+	MaxChanges int
+	// BatchSize is the number of writes per applyWrites call. Defaults to MaxBatchSize.
+	BatchSize int
+
+	client *xrpc.Client
+	set    didset.DIDSet
+}
+
+type blockState struct {
+	// Blocks maps blocked DIDs to record keys.
+	Blocks map[string]string `json:"blocks"`
+}
+
+func NewBlockSyncer(authclient *xrpc.Client, set didset.DIDSet) *BlockSyncer {
+	return &BlockSyncer{
+		client: authclient,
+		set:    set,
+	}
+}
+
+func (s *BlockSyncer) Sync(ctx context.Context) (*Result, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "reconcile").
+		Str("records", "blocks").
+		Bool("dry_run", s.DryRun).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	session, err := comatproto.ServerGetSession(ctx, s.client)
+	if err != nil {
+		return nil, fmt.Errorf("ServerGetSession: %w", err)
+	}
+	self := session.Did
+
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := s.set.GetDIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the DID set: %w", err)
+	}
+	delete(want, self)
+	existing, err := blockRecords(ctx, s.client, self)
+	if err != nil {
+		return nil, err
+	}
+
+	// Forget blocks that were deleted outside of the syncer.
+	for did, rkey := range state.Blocks {
+		if existing[rkey] != did {
+			delete(state.Blocks, did)
+		}
+	}
+	blocked := map[string]bool{}
+	for _, did := range existing {
+		blocked[did] = true
+	}
+
+	result := &Result{}
+	writes := []*write{}
+	// updates[i] is applied to the state once writes[i] is successfully written.
+	updates := []func(){}
+
+	for did, rkey := range state.Blocks {
+		if want[did] {
+			continue
+		}
+		did, rkey := did, rkey
+		result.Removed = append(result.Removed, did)
+		writes = append(writes, deleteWrite("app.bsky.graph.block", rkey))
+		updates = append(updates, func() { delete(state.Blocks, did) })
+	}
+	for did := range want {
+		if blocked[did] {
+			continue
+		}
+		did := did
+		result.Added = append(result.Added, did)
+		w, rkey := createWrite("app.bsky.graph.block", &bsky.GraphBlock{
+			Subject:   did,
+			CreatedAt: now(),
+		})
+		writes = append(writes, w)
+		updates = append(updates, func() { state.Blocks[did] = rkey })
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+
+	log.Info().Msgf("Blocking %d, unblocking %d accounts", len(result.Added), len(result.Removed))
+	if s.MaxChanges > 0 && len(writes) > s.MaxChanges {
+		return result, fmt.Errorf("%w: %d changes needed, limit is %d", ErrTooManyChanges, len(writes), s.MaxChanges)
+	}
+
+	if s.DryRun {
+		for _, did := range result.Added {
+			log.Info().Str("did", did).Msgf("Would block")
+		}
+		for _, did := range result.Removed {
+			log.Info().Str("did", did).Msgf("Would unblock")
+		}
+		return result, nil
+	}
+
+	n, err := applyWrites(ctx, s.client, self, writes, s.BatchSize)
+	for _, update := range updates[:n] {
+		update()
+	}
+	if saveErr := s.saveState(state); saveErr != nil {
+		return result, errors.Join(err, saveErr)
+	}
+	if err != nil {
+		return result, fmt.Errorf("applied %d out of %d changes: %w", n, len(writes), err)
+	}
+	return result, nil
+}
+
+// blockRecords returns subjects of block records in the repo, keyed by record key.
+func blockRecords(ctx context.Context, client *xrpc.Client, did string) (map[string]string, error) {
+	r := map[string]string{}
+	err := pagination.ListRecords(ctx, client, did, "app.bsky.graph.block", func(rec *comatproto.RepoListRecords_Record) bool {
+		if item, ok := rec.Value.Val.(*bsky.GraphBlock); ok {
+			parts := strings.Split(rec.Uri, "/")
+			r[parts[len(parts)-1]] = item.Subject
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing block records: %w", err)
+	}
+	return r, nil
+}
+
+func (s *BlockSyncer) loadState() (*blockState, error) {
+	state := &blockState{Blocks: map[string]string{}}
+	if s.StateFile == "" {
+		return state, nil
+	}
+
+	b, err := os.ReadFile(s.StateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("parsing state file %q: %w", s.StateFile, err)
+	}
+	if state.Blocks == nil {
+		state.Blocks = map[string]string{}
+	}
+	return state, nil
+}
+
+func (s *BlockSyncer) saveState(state *blockState) error {
+	if s.StateFile == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	if err := atomicfile.WriteFile(s.StateFile, b, 0644); err != nil {
+		return fmt.Errorf("saving state file: %w", err)
+	}
+	return nil
+}
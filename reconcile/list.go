@@ -0,0 +1,124 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/uabluerail/bsky-tools/aturl"
+	"github.com/uabluerail/bsky-tools/didset"
+)
+
+// ListSyncer adds and removes list items to make members of a list
+// match the given DID set. The client must be authenticated as the list owner.
+type ListSyncer struct {
+	// DryRun disables all writes. Planned changes are still logged and returned.
+	DryRun bool
+	// MaxChanges, if positive, makes Sync fail with ErrTooManyChanges
+	// instead of making more changes than that, also with DryRun.
+	MaxChanges int
+	// BatchSize is the number of writes per applyWrites call. Defaults to MaxBatchSize.
+	BatchSize int
+
+	client *xrpc.Client
+	uri    string
+	set    didset.DIDSet
+}
+
+func NewListSyncer(authclient *xrpc.Client, listURI string, set didset.DIDSet) *ListSyncer {
+	return &ListSyncer{
+		client: authclient,
+		uri:    listURI,
+		set:    set,
+	}
+}
+
+func (s *ListSyncer) Sync(ctx context.Context) (*Result, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("module", "reconcile").
+		Str("list", s.uri).
+		Bool("dry_run", s.DryRun).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	u, err := aturl.Parse(s.uri)
+	if err != nil {
+		return nil, fmt.Errorf("parsing list URI %q: %w", s.uri, err)
+	}
+	if u.Scheme != "at" || u.Host == "" {
+		return nil, fmt.Errorf("list URI must be an at:// URI, got %q", s.uri)
+	}
+	owner, err := resolveRepo(ctx, s.client, u.Host)
+	if err != nil {
+		return nil, err
+	}
+	u.Host = owner
+	listURI := u.String()
+
+	want, err := s.set.GetDIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the DID set: %w", err)
+	}
+	items, err := didset.List(s.client, listURI, didset.ListFromRecords).GetItems(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching list items: %w", err)
+	}
+
+	result := &Result{}
+	writes := []*write{}
+	for did, rkeys := range items {
+		sort.Strings(rkeys)
+		if !want[did] {
+			result.Removed = append(result.Removed, did)
+			for _, rkey := range rkeys {
+				writes = append(writes, deleteWrite("app.bsky.graph.listitem", rkey))
+			}
+			continue
+		}
+		// Keep the oldest record and delete the rest.
+		for _, rkey := range rkeys[1:] {
+			result.Duplicates++
+			writes = append(writes, deleteWrite("app.bsky.graph.listitem", rkey))
+		}
+	}
+	for did := range want {
+		if _, ok := items[did]; ok {
+			continue
+		}
+		result.Added = append(result.Added, did)
+		w, _ := createWrite("app.bsky.graph.listitem", &bsky.GraphListitem{
+			List:      listURI,
+			Subject:   did,
+			CreatedAt: now(),
+		})
+		writes = append(writes, w)
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+
+	log.Info().Msgf("Adding %d, removing %d accounts, %d duplicate items", len(result.Added), len(result.Removed), result.Duplicates)
+	if s.MaxChanges > 0 && len(writes) > s.MaxChanges {
+		return result, fmt.Errorf("%w: %d changes needed, limit is %d", ErrTooManyChanges, len(writes), s.MaxChanges)
+	}
+
+	if s.DryRun {
+		for _, did := range result.Added {
+			log.Info().Str("did", did).Msgf("Would add to the list")
+		}
+		for _, did := range result.Removed {
+			log.Info().Str("did", did).Msgf("Would remove from the list")
+		}
+		return result, nil
+	}
+
+	n, err := applyWrites(ctx, s.client, owner, writes, s.BatchSize)
+	if err != nil {
+		return result, fmt.Errorf("applied %d out of %d changes: %w", n, len(writes), err)
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+// Package reconcile creates and deletes records in a repo to make them match a DID set.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// MaxBatchSize is the maximum number of writes the PDS accepts in a single applyWrites call.
+const MaxBatchSize = 200
+
+// ErrTooManyChanges is returned when the number of changes needed exceeds
+// the configured limit. Nothing is written in that case.
+var ErrTooManyChanges = errors.New("too many changes")
+
+type Result struct {
+	// Added and Removed contain DIDs of accounts whose records were created or deleted.
+	Added   []string
+	Removed []string
+	// Duplicates is the number of redundant records deleted, when there was
+	// more than one record for the same account.
+	Duplicates int
+}
+
+func (r *Result) Changes() int {
+	return len(r.Added) + len(r.Removed) + r.Duplicates
+}
+
+type write = comatproto.RepoApplyWrites_Input_Writes_Elem
+
+// tids generates record keys for new records. Unlike repo.NextTID, it never
+// returns the same or a smaller TID twice, even if the system clock goes back.
+var tids = syntax.NewTIDClock(uint(rand.Intn(1024)))
+
+// createWrite returns a write that creates a record with a new TID as a key.
+func createWrite(collection string, record cbg.CBORMarshaler) (*write, string) {
+	rkey := tids.Next().String()
+	return &write{RepoApplyWrites_Create: &comatproto.RepoApplyWrites_Create{
+		Collection: collection,
+		Rkey:       &rkey,
+		Value:      &lexutil.LexiconTypeDecoder{Val: record},
+	}}, rkey
+}
+
+func deleteWrite(collection string, rkey string) *write {
+	return &write{RepoApplyWrites_Delete: &comatproto.RepoApplyWrites_Delete{
+		Collection: collection,
+		Rkey:       rkey,
+	}}
+}
+
+// applyWrites sends writes in batches of batchSize. Returns the number of writes
+// successfully applied along with the error.
+func applyWrites(ctx context.Context, client *xrpc.Client, did string, writes []*write, batchSize int) (int, error) {
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		batchSize = MaxBatchSize
+	}
+
+	// The whole batch fails if two writes touch the same record, so check
+	// all batches before applying any of them.
+	for i := 0; i < len(writes); i += batchSize {
+		if err := checkBatch(writes[i:min(i+batchSize, len(writes))]); err != nil {
+			return 0, err
+		}
+	}
+
+	done := 0
+	for len(writes) > 0 {
+		n := min(batchSize, len(writes))
+		err := comatproto.RepoApplyWrites(ctx, client, &comatproto.RepoApplyWrites_Input{
+			Repo:   did,
+			Writes: writes[:n],
+		})
+		if err != nil {
+			return done, fmt.Errorf("com.atproto.repo.applyWrites: %w", err)
+		}
+		done += n
+		writes = writes[n:]
+	}
+	return done, nil
+}
+
+// checkBatch returns an error if more than one write in the batch has the same key.
+func checkBatch(writes []*write) error {
+	seen := map[string]bool{}
+	for _, w := range writes {
+		var key string
+		switch {
+		case w.RepoApplyWrites_Create != nil && w.RepoApplyWrites_Create.Rkey != nil:
+			key = w.RepoApplyWrites_Create.Collection + "/" + *w.RepoApplyWrites_Create.Rkey
+		case w.RepoApplyWrites_Update != nil:
+			key = w.RepoApplyWrites_Update.Collection + "/" + w.RepoApplyWrites_Update.Rkey
+		case w.RepoApplyWrites_Delete != nil:
+			key = w.RepoApplyWrites_Delete.Collection + "/" + w.RepoApplyWrites_Delete.Rkey
+		default:
+			continue
+		}
+		if seen[key] {
+			return fmt.Errorf("more than one write for record %q in the same batch", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// resolveRepo returns the DID for a DID or a handle.
+func resolveRepo(ctx context.Context, client *xrpc.Client, repo string) (string, error) {
+	if strings.HasPrefix(repo, "did:") {
+		return repo, nil
+	}
+	resp, err := comatproto.IdentityResolveHandle(ctx, client, repo)
+	if err != nil {
+		return "", fmt.Errorf("resolving handle %q: %w", repo, err)
+	}
+	return resp.Did, nil
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
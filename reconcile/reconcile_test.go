@@ -0,0 +1,53 @@
+package reconcile
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+func TestCreateWriteKeysIncrease(t *testing.T) {
+	prev := ""
+	for i := 0; i < 10000; i++ {
+		_, rkey := createWrite("app.bsky.graph.block", &bsky.GraphBlock{})
+		if rkey <= prev {
+			t.Fatalf("key %q is not greater than the previous one %q", rkey, prev)
+		}
+		prev = rkey
+	}
+}
+
+func TestApplyWritesRejectsDuplicateKeys(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+	client := &xrpc.Client{Host: srv.URL}
+
+	w, rkey := createWrite("app.bsky.graph.block", &bsky.GraphBlock{})
+	other, _ := createWrite("app.bsky.graph.block", &bsky.GraphBlock{})
+	writes := []*write{deleteWrite("app.bsky.graph.block", rkey), w, other}
+
+	n, err := applyWrites(context.Background(), client, "did:plc:owner", writes, 2)
+	if err == nil || n != 0 {
+		t.Errorf("got %d writes applied and error %v, want a duplicate key error", n, err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("got %d requests, want none", requests.Load())
+	}
+
+	// The same writes are fine when they end up in different batches.
+	n, err = applyWrites(context.Background(), client, "did:plc:owner", writes, 1)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if n != len(writes) {
+		t.Errorf("got %d writes applied, want %d", n, len(writes))
+	}
+}